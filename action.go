@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/google/go-github/v35/github"
+	"github.com/labstack/echo/v4"
+	"github.com/yskszk63/cancel-workflow-run/guard"
+)
+
+const defaultGitHubApiUrl = "https://api.github.com"
+
+// actionsBotLogin comments with GITHUB_TOKEN.
+const actionsBotLogin = "github-actions[bot]"
+
+// newActionEnv returns env on GitHub Actions. GITHUB_API_URL is the url of GitHub Enterprise Server.
+func newActionEnv(conf *config, getenv func(string) string) env {
+	c := *conf
+	c.GitHubBaseUrl = nil
+	if apiUrl := getenv("GITHUB_API_URL"); apiUrl != "" && apiUrl != defaultGitHubApiUrl {
+		c.GitHubBaseUrl = &apiUrl
+	}
+	return newEnv(&c)
+}
+
+// tokenTransport authorizes by GITHUB_TOKEN.
+type tokenTransport struct {
+	token string
+	base  http.RoundTripper
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "token "+t.token)
+	return t.base.RoundTrip(req)
+}
+
+// actionLogin returns the user of the token. GITHUB_TOKEN can not get the user, and comments as github-actions[bot].
+func actionLogin(client *github.Client) string {
+	user, _, err := client.Users.Get(context.Background(), "")
+	if err != nil || user.GetLogin() == "" {
+		return actionsBotLogin
+	}
+	return user.GetLogin()
+}
+
+// runAction checks workflow runs of the pull request as a GitHub Action on pull_request_target.
+// Runs of the head sha are checked by the same logic as process.
+func runAction(env env, getenv func(string) string, logger echo.Logger) error {
+	eventName := getenv("GITHUB_EVENT_NAME")
+	if eventName != "pull_request_target" && eventName != "pull_request" {
+		logger.Warnf("%s is not supported. nothing to do.", eventName)
+		return nil
+	}
+
+	token := getenv("GITHUB_TOKEN")
+	if token == "" {
+		return fmt.Errorf("no GITHUB_TOKEN specified.")
+	}
+
+	payload, err := os.ReadFile(getenv("GITHUB_EVENT_PATH"))
+	if err != nil {
+		return err
+	}
+	event := new(github.PullRequestEvent)
+	if err := json.Unmarshal(payload, event); err != nil {
+		return err
+	}
+	switch event.GetAction() {
+	case "opened", "synchronize", "reopened":
+	default:
+		logger.Infof("%s %s: nothing to do.", eventName, event.GetAction())
+		return nil
+	}
+
+	client := newGitHubClient(env, &http.Client{Transport: &tokenTransport{token: token, base: http.DefaultTransport}})
+	k := &checker{
+		client:   client,
+		env:      env,
+		store:    newMemoryStore(),
+		logger:   logger,
+		renderer: newTemplateRenderer(),
+		login:    actionLogin(client),
+		// the approve button of the check run is not delivered to actions.
+		withoutChecks: true,
+	}
+
+	owner := event.GetRepo().GetOwner().GetLogin()
+	repo := event.GetRepo().GetName()
+	pr := event.GetPullRequest()
+
+	// re-run of this action is also an approval.
+	attempt, _ := strconv.Atoi(getenv("GITHUB_RUN_ATTEMPT"))
+	actor := getenv("GITHUB_TRIGGERING_ACTOR")
+	if actor == "" {
+		actor = getenv("GITHUB_ACTOR")
+	}
+	self := getenv("GITHUB_RUN_ID")
+
+	for _, status := range []string{"queued", "in_progress"} {
+		runs, err := guard.ListRunsForSha(context.Background(), guard.NewClient(client), owner, repo, pr.GetHead().GetRef(), pr.GetHead().GetSHA(), status)
+		if err != nil {
+			return err
+		}
+		for _, run := range runs {
+			if strconv.FormatInt(run.GetID(), 10) == self {
+				continue
+			}
+			msg := &queueMessage{
+				Owner:           owner,
+				RepositoryName:  repo,
+				WorkflowRunId:   run.GetID(),
+				PullRequestNums: []int{pr.GetNumber()},
+				RunAttempt:      attempt,
+				TriggeringActor: actor,
+			}
+			if err := k.checkWorkflowRun(context.Background(), msg); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/google/go-github/v35/github"
+	"github.com/labstack/echo/v4"
+)
+
+func TestActionEnv(t *testing.T) {
+	tests := []struct {
+		name   string
+		apiUrl string
+		want   *string
+	}{
+		{name: "github.com", apiUrl: "https://api.github.com"},
+		{name: "unset"},
+		{name: "enterprise", apiUrl: "https://ghes/api/v3", want: github.String("https://ghes/api/v3")},
+	}
+
+	for _, c := range tests {
+		t.Run(c.name, func(t *testing.T) {
+			env := newActionEnv(defaultConfig(), func(key string) string {
+				if key == "GITHUB_API_URL" {
+					return c.apiUrl
+				}
+				return ""
+			})
+			if got := env.config().GitHubBaseUrl; !reflect.DeepEqual(got, c.want) {
+				t.Fatal(got)
+			}
+		})
+	}
+}
+
+func TestRunAction(t *testing.T) {
+	tests := []struct {
+		name      string
+		eventName string
+		action    string
+		token     string
+		wantErr   bool
+		wantRuns  []string
+	}{
+		{
+			name:      "checked",
+			eventName: "pull_request_target",
+			action:    "opened",
+			token:     "token",
+			wantRuns:  []string{"/api/v3/repos/o/r/actions/runs/2", "/api/v3/repos/o/r/actions/runs/3"},
+		},
+		{
+			name:      "closed",
+			eventName: "pull_request_target",
+			action:    "closed",
+			token:     "token",
+		},
+		{
+			name:      "push",
+			eventName: "push",
+			action:    "opened",
+			token:     "token",
+		},
+		{
+			name:      "no token",
+			eventName: "pull_request_target",
+			action:    "opened",
+			wantErr:   true,
+		},
+	}
+
+	for _, c := range tests {
+		t.Run(c.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var gotRuns []string
+			dummy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Authorization") != "token token" {
+					w.WriteHeader(401)
+					return
+				}
+				switch r.URL.Path {
+				case "/api/v3/repos/o/r/actions/runs":
+					switch r.URL.Query().Get("status") {
+					case "queued":
+						// 1 is the action itself. 9 is another sha.
+						fmt.Fprint(w, `{"workflow_runs":[{"id":1,"head_sha":"sha"},{"id":2,"head_sha":"sha"},{"id":9,"head_sha":"other"}]}`)
+					default:
+						fmt.Fprint(w, `{"workflow_runs":[{"id":3,"head_sha":"sha"}]}`)
+					}
+				case "/api/v3/repos/o/r/actions/runs/2", "/api/v3/repos/o/r/actions/runs/3":
+					mu.Lock()
+					gotRuns = append(gotRuns, r.URL.Path)
+					mu.Unlock()
+					fmt.Fprint(w, `{"id":2,"workflow_id":1,"head_sha":"sha"}`)
+				case "/api/v3/repos/o/r/actions/workflows/1":
+					fmt.Fprint(w, `{"id":1,"path":".github/workflows/ci.yml"}`)
+				case "/api/v3/repos/o/r/contents/.github/cancel-workflow-run.yml":
+					content := base64.StdEncoding.EncodeToString([]byte("enabled: false\n"))
+					fmt.Fprintf(w, `{"type":"file","encoding":"base64","content":%q}`, content)
+				default:
+					fmt.Printf("%s\n", r.URL)
+					w.WriteHeader(501)
+				}
+			}))
+			defer dummy.Close()
+
+			eventPath := filepath.Join(t.TempDir(), "event.json")
+			event := fmt.Sprintf(`{"action":%q,"number":1,"pull_request":{"number":1,"head":{"ref":"topic","sha":"sha"}},"repository":{"name":"r","owner":{"login":"o"}}}`, c.action)
+			if err := os.WriteFile(eventPath, []byte(event), 0644); err != nil {
+				t.Fatal(err)
+			}
+			vars := map[string]string{
+				"GITHUB_EVENT_NAME": c.eventName,
+				"GITHUB_EVENT_PATH": eventPath,
+				"GITHUB_TOKEN":      c.token,
+				"GITHUB_RUN_ID":     "1",
+			}
+
+			err := runAction(newTestEnv(dummy.URL), func(key string) string { return vars[key] }, echo.New().Logger)
+			if (err != nil) != c.wantErr {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(gotRuns, c.wantRuns) {
+				t.Fatal(gotRuns)
+			}
+		})
+	}
+}
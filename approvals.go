@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// approval allows workflow runs of the head sha.
+type approval struct {
+	Sha string    `json:"sha"`
+	By  string    `json:"by"`
+	At  time.Time `json:"at"`
+	// how approved. e.g. re-run
+	Via string `json:"via"`
+}
+
+func approvalKey(owner, repo, sha string) string {
+	return fmt.Sprintf("approvals/%s/%s/%s", owner, repo, sha)
+}
+
+func recordApproval(context context.Context, store kvStore, owner, repo string, a *approval) error {
+	j, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	return store.put(context, approvalKey(owner, repo, a.Sha), j)
+}
+
+// findApproval returns nil if not approved.
+func findApproval(context context.Context, store kvStore, owner, repo, sha string) (*approval, error) {
+	if sha == "" {
+		return nil, nil
+	}
+	j, err := store.get(context, approvalKey(owner, repo, sha))
+	if err != nil || j == nil {
+		return nil, err
+	}
+
+	a := new(approval)
+	if err := json.Unmarshal(j, a); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
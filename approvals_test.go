@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestApproval(t *testing.T) {
+	store := newMemoryStore()
+
+	a, err := findApproval(context.Background(), store, "o", "r", "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != nil {
+		t.Fatal(a)
+	}
+
+	err = recordApproval(context.Background(), store, "o", "r", &approval{
+		Sha: "abc",
+		By:  "maintainer",
+		At:  time.Unix(0, 0).UTC(),
+		Via: "re-run",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err = findApproval(context.Background(), store, "o", "r", "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a == nil || a.By != "maintainer" || a.Via != "re-run" || !a.At.Equal(time.Unix(0, 0)) {
+		t.Fatalf("%+v", a)
+	}
+
+	a, err = findApproval(context.Background(), store, "o", "other", "abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != nil {
+		t.Fatal(a)
+	}
+}
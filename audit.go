@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/yskszk63/cancel-workflow-run/guard"
+)
+
+// kinds of audit records.
+const (
+	auditWorkflowRun = "workflow_run"
+	auditWorkflowJob = "workflow_job"
+	auditAutoApprove = "auto_approve"
+)
+
+// auditRecord is a decision of the bot on an evaluated run.
+type auditRecord struct {
+	At             time.Time `json:"at"`
+	Kind           string    `json:"kind"`
+	InstallationId int64     `json:"installationId"`
+	Owner          string    `json:"owner"`
+	Repo           string    `json:"repo"`
+	PullRequest    int       `json:"pullRequest,omitempty"`
+	RunId          int64     `json:"runId"`
+	Sha            string    `json:"sha,omitempty"`
+	// Files are considered to decide.
+	Files []string `json:"files,omitempty"`
+	// Decision is e.g. cancel, skip or approve.
+	Decision string               `json:"decision"`
+	Reasons  []string             `json:"reasons,omitempty"`
+	DryRun   bool                 `json:"dryRun,omitempty"`
+	Actions  []guard.ActionResult `json:"actions,omitempty"`
+}
+
+// auditLog keeps audit records in the store per installation and repository,
+// partitioned by the day to query by time range.
+type auditLog struct {
+	store kvStore
+}
+
+func newAuditLog(store kvStore) *auditLog {
+	return &auditLog{store: store}
+}
+
+const auditDayLayout = "2006-01-02"
+
+func auditPrefix(installationId int64, owner, repo string) string {
+	return fmt.Sprintf("audit/%d/%s/%s/", installationId, owner, repo)
+}
+
+func auditKey(r *auditRecord) string {
+	at := r.At.UTC()
+	return fmt.Sprintf("%s%s/%s-%d-%d-%s.json", auditPrefix(r.InstallationId, r.Owner, r.Repo), at.Format(auditDayLayout), at.Format("150405.000000000"), r.RunId, r.PullRequest, r.Kind)
+}
+
+func (a *auditLog) record(context context.Context, r *auditRecord) error {
+	j, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return a.store.put(context, auditKey(r), j)
+}
+
+// query returns records of the repository in [from, to) in order.
+func (a *auditLog) query(context context.Context, installationId int64, owner, repo string, from, to time.Time) ([]*auditRecord, error) {
+	var result []*auditRecord
+	from, to = from.UTC(), to.UTC()
+	for day := from.Truncate(24 * time.Hour); day.Before(to); day = day.Add(24 * time.Hour) {
+		keys, err := a.store.list(context, auditPrefix(installationId, owner, repo)+day.Format(auditDayLayout)+"/")
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			j, err := a.store.get(context, key)
+			if err != nil {
+				return nil, err
+			}
+			if j == nil {
+				continue
+			}
+			r := new(auditRecord)
+			if err := json.Unmarshal(j, r); err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			if r.At.Before(from) || !r.At.Before(to) {
+				continue
+			}
+			result = append(result, r)
+		}
+	}
+	return result, nil
+}
+
+// recordAudit does not fail the job. The decision is already applied.
+func (k *checker) recordAudit(context context.Context, r *auditRecord) {
+	runsEvaluated.inc(r.Kind, r.Decision)
+	if k.store == nil {
+		return
+	}
+	if r.At.IsZero() {
+		r.At = k.env.now()
+	}
+	if err := newAuditLog(k.store).record(context, r); err != nil {
+		k.logger.Errorf("audit: %s", err)
+	}
+}
+
+// runAudit prints audit records of the repository as json lines.
+func runAudit(env env, args []string, w io.Writer) error {
+	flags := flag.NewFlagSet("audit", flag.ContinueOnError)
+	installationId := flags.Int64("installation", 0, "installation id (required)")
+	owner := flags.String("owner", "", "owner of the repository (required)")
+	repo := flags.String("repo", "", "name of the repository (required)")
+	since := flags.Duration("since", 24*time.Hour, "query records since the duration ago")
+	fromFlag := flags.String("from", "", "query records from the time. (RFC3339, overrides -since)")
+	toFlag := flags.String("to", "", "query records until the time. (RFC3339, default: now)")
+	stateDir := flags.String("state-dir", "", "directory of the state. (default: AzureWebJobsStorage)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	// records are kept per installation. a wrong one finds nothing silently.
+	if *installationId <= 0 || *owner == "" || *repo == "" {
+		return fmt.Errorf("-installation, -owner and -repo are required")
+	}
+
+	to := env.now()
+	if *toFlag != "" {
+		t, err := time.Parse(time.RFC3339, *toFlag)
+		if err != nil {
+			return err
+		}
+		to = t
+	}
+	from := to.Add(-*since)
+	if *fromFlag != "" {
+		t, err := time.Parse(time.RFC3339, *fromFlag)
+		if err != nil {
+			return err
+		}
+		from = t
+	}
+
+	var store kvStore
+	if *stateDir != "" {
+		store = newFileStore(*stateDir)
+	} else {
+		if err := env.config().require(storageSettings...); err != nil {
+			return err
+		}
+		store = newBlobStore(env, "state")
+	}
+
+	records, err := newAuditLog(store).query(context.Background(), *installationId, *owner, *repo, from, to)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	for _, r := range records {
+		if err := encoder.Encode(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
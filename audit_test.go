@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testAuditLog(t *testing.T, store kvStore) {
+	ctx := context.Background()
+	log := newAuditLog(store)
+
+	day := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	records := []*auditRecord{
+		{At: day.Add(23 * time.Hour), Kind: auditWorkflowRun, InstallationId: 1, Owner: "o", Repo: "r", RunId: 1, Decision: "cancel"},
+		{At: day.Add(25 * time.Hour), Kind: auditWorkflowRun, InstallationId: 1, Owner: "o", Repo: "r", RunId: 2, Decision: "skip"},
+		{At: day.Add(25 * time.Hour), Kind: auditWorkflowRun, InstallationId: 1, Owner: "o", Repo: "other", RunId: 3},
+		{At: day.Add(25 * time.Hour), Kind: auditWorkflowRun, InstallationId: 2, Owner: "o", Repo: "r", RunId: 4},
+	}
+	for _, r := range records {
+		if err := log.record(ctx, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		name     string
+		from, to time.Time
+		want     []int64
+	}{
+		{
+			name: "across days",
+			from: day,
+			to:   day.Add(48 * time.Hour),
+			want: []int64{1, 2},
+		},
+		{
+			name: "first day",
+			from: day,
+			to:   day.Add(24 * time.Hour),
+			want: []int64{1},
+		},
+		{
+			name: "within the day",
+			from: day.Add(24*time.Hour + time.Minute),
+			to:   day.Add(26 * time.Hour),
+			want: []int64{2},
+		},
+		{
+			name: "other timezone",
+			from: day.In(time.FixedZone("JST", 9*60*60)),
+			to:   day.Add(24 * time.Hour).In(time.FixedZone("JST", 9*60*60)),
+			want: []int64{1},
+		},
+		{
+			name: "empty",
+			from: day.Add(-48 * time.Hour),
+			to:   day,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			result, err := log.query(ctx, 1, "o", "r", c.from, c.to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []int64
+			for _, r := range result {
+				ids = append(ids, r.RunId)
+			}
+			if len(ids) != len(c.want) {
+				t.Fatal(ids)
+			}
+			for i := range ids {
+				if ids[i] != c.want[i] {
+					t.Fatal(ids)
+				}
+			}
+		})
+	}
+}
+
+func TestAuditLogMemory(t *testing.T) {
+	testAuditLog(t, newMemoryStore())
+}
+
+func TestAuditLogFile(t *testing.T) {
+	testAuditLog(t, newFileStore(t.TempDir()))
+}
+
+func TestAuditLogBlob(t *testing.T) {
+	dummy := newDummyBlobServer()
+	defer dummy.Close()
+
+	testAuditLog(t, newBlobStore(newTestEnv(dummy.URL), "state"))
+}
+
+func TestRunAudit(t *testing.T) {
+	dir := t.TempDir()
+	at := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	err := newAuditLog(newFileStore(dir)).record(context.Background(), &auditRecord{
+		At: at, Kind: auditWorkflowJob, InstallationId: 1, Owner: "o", Repo: "r", RunId: 1, Decision: "cancel",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := new(bytes.Buffer)
+	args := []string{"-state-dir", dir, "-installation", "1", "-owner", "o", "-repo", "r", "-to", "2021-06-02T00:00:00Z", "-since", "24h"}
+	if err := runAudit(newEnv(defaultConfig()), args, out); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatal(out.String())
+	}
+	r := new(auditRecord)
+	if err := json.Unmarshal([]byte(lines[0]), r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Kind != auditWorkflowJob || r.Decision != "cancel" || !r.At.Equal(at) {
+		t.Fatalf("%+v", r)
+	}
+
+	if err := runAudit(newEnv(defaultConfig()), []string{"-installation", "1", "-owner", "o"}, out); err == nil {
+		t.Fatal("no repo")
+	}
+	if err := runAudit(newEnv(defaultConfig()), []string{"-state-dir", dir, "-owner", "o", "-repo", "r"}, out); err == nil {
+		t.Fatal("no installation")
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+
+	"github.com/google/go-github/v35/github"
+	"github.com/yskszk63/cancel-workflow-run/guard"
+)
+
+// autoApprove approves the fork run held in action_required,
+// if pull requests change no sensitive path, nor the workflow and files it executes.
+func (k *checker) autoApprove(context context.Context, msg *queueMessage, run *github.WorkflowRun, workflow *github.Workflow, policy *guard.Policy, pullRequestNums []int) error {
+	if !policy.AutoApprove.Enabled {
+		return nil
+	}
+
+	gclient := k.guardClient()
+	decider := guard.NewDecider(policy)
+	decision := &guard.ApprovalDecision{Reason: "no pull request"}
+	var considered []string
+	for _, prnum := range pullRequestNums {
+		pr, _, err := k.client.PullRequests.Get(context, msg.Owner, msg.RepositoryName, prnum)
+		if err != nil {
+			return err
+		}
+		// the head may be pushed after the run, and files of the run are unknown.
+		if pr.GetHead().GetSHA() != run.GetHeadSHA() {
+			decision = &guard.ApprovalDecision{Reason: guard.ReasonNotHead}
+			break
+		}
+		input, err := decider.GatherAutoApprove(context, gclient, msg.Owner, msg.RepositoryName, run, workflow, pr)
+		if err != nil {
+			return err
+		}
+		for _, f := range input.Files {
+			considered = append(considered, f.GetFilename())
+		}
+		decision = decider.DecideAutoApprove(input)
+		if !decision.Approve {
+			break
+		}
+	}
+
+	record := &auditRecord{
+		Kind:           auditAutoApprove,
+		InstallationId: msg.InstallationId,
+		Owner:          msg.Owner,
+		Repo:           msg.RepositoryName,
+		RunId:          run.GetID(),
+		Sha:            run.GetHeadSHA(),
+		Files:          considered,
+		Decision:       "skip",
+		Reasons:        []string{decision.Reason},
+		DryRun:         policy.DryRun,
+	}
+	if len(pullRequestNums) > 0 {
+		record.PullRequest = pullRequestNums[0]
+	}
+	if decision.Approve {
+		record.Decision = "approve"
+	}
+	if decision.Approve && !policy.DryRun {
+		result := guard.ActionResult{Action: "approve", Target: run.GetHTMLURL(), Result: "approved"}
+		if _, err := guard.ApproveWorkflowRunByID(context, gclient, msg.Owner, msg.RepositoryName, run.GetID()); err != nil {
+			result.Result = ""
+			result.Error = err.Error()
+			record.Actions = append(record.Actions, result)
+			k.recordAudit(context, record)
+			return err
+		}
+		record.Actions = append(record.Actions, result)
+	}
+	k.recordAudit(context, record)
+
+	switch {
+	case !decision.Approve:
+		k.logger.Infof("%s: not approved automatically. (%s)", run.GetHTMLURL(), decision.Reason)
+	case policy.DryRun:
+		k.logger.Infof("dry run: %s would be approved automatically. (%s)", run.GetHTMLURL(), decision.Reason)
+	default:
+		k.logger.Infof("%s: approved automatically. (%s)", run.GetHTMLURL(), decision.Reason)
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v35/github"
+	"github.com/labstack/echo/v4"
+	"github.com/yskszk63/cancel-workflow-run/guard"
+)
+
+func TestAutoApprove(t *testing.T) {
+	cases := []struct {
+		name   string
+		policy func(*guard.Policy)
+		files  string
+		head   string
+		// base is the workflow on the base branch.
+		base         string
+		wantApprove  bool
+		wantDecision string
+		wantReason   string
+	}{
+		{
+			name:         "ok",
+			files:        `[{"filename":"main.go","status":"modified"}]`,
+			wantApprove:  true,
+			wantDecision: "approve",
+			wantReason:   "no sensitive path changed",
+		},
+		{
+			name:         "workflow",
+			files:        `[{"filename":".github/workflows/ci.yml","status":"modified"}]`,
+			wantDecision: "skip",
+			wantReason:   "sensitive path .github/workflows/ci.yml changed",
+		},
+		{
+			name:         "sensitive path",
+			policy:       func(p *guard.Policy) { p.AutoApprove.SensitivePaths = []string{"scripts/"} },
+			files:        `[{"filename":"scripts/test.sh","status":"added"}]`,
+			wantDecision: "skip",
+			wantReason:   "sensitive path scripts/test.sh changed",
+		},
+		{
+			name:         "executed file",
+			files:        `[{"filename":"Makefile","status":"modified"}]`,
+			base:         "jobs: {test: {steps: [{run: make test}]}}",
+			wantDecision: "skip",
+			wantReason:   "currently could not accept Makefile executed by the workflow changed at pull request (run: make test)",
+		},
+		{
+			name:         "pushed after the run",
+			files:        `[{"filename":"main.go","status":"modified"}]`,
+			head:         "def",
+			wantDecision: "skip",
+			wantReason:   guard.ReasonNotHead,
+		},
+		{
+			name:         "dry run",
+			policy:       func(p *guard.Policy) { p.DryRun = true },
+			files:        `[{"filename":"main.go","status":"modified"}]`,
+			wantDecision: "approve",
+			wantReason:   "no sensitive path changed",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			approved := false
+			dummy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/api/v3/repos/o/r/pulls/1":
+					head := c.head
+					if head == "" {
+						head = "abc"
+					}
+					fmt.Fprintf(w, `{"number":1,"changed_files":1,"head":{"sha":%q}}`, head)
+				case "/api/v3/repos/o/r/pulls/1/files":
+					fmt.Fprint(w, c.files)
+				case "/api/v3/repos/o/r/contents/.github/workflows/ci.yml":
+					if c.base == "" {
+						w.WriteHeader(404)
+						return
+					}
+					fmt.Fprintf(w, `{"type":"file","encoding":"base64","content":%q}`, base64.StdEncoding.EncodeToString([]byte(c.base)))
+				case "/api/v3/repos/o/r/actions/runs/2/approve":
+					approved = true
+					w.WriteHeader(201)
+				default:
+					fmt.Printf("%s\n", r.URL)
+					w.WriteHeader(501)
+				}
+			}))
+			defer dummy.Close()
+
+			env := newTestEnv(dummy.URL)
+			store := newMemoryStore()
+			k := &checker{
+				client: newGitHubClient(env, nil),
+				env:    env,
+				store:  store,
+				logger: echo.New().Logger,
+			}
+			policy := guard.DefaultPolicy()
+			policy.AutoApprove.Enabled = true
+			if c.policy != nil {
+				c.policy(policy)
+			}
+
+			run := &github.WorkflowRun{ID: github.Int64(2), HeadSHA: github.String("abc")}
+			msg := &queueMessage{Owner: "o", RepositoryName: "r"}
+			workflow := &github.Workflow{Path: github.String(".github/workflows/ci.yml")}
+			if err := k.autoApprove(context.Background(), msg, run, workflow, policy, []int{1}); err != nil {
+				t.Fatal(err)
+			}
+			if approved != c.wantApprove {
+				t.Fatalf("approved: %v", approved)
+			}
+
+			records, err := newAuditLog(store).query(context.Background(), 0, "o", "r", env.now().Add(-time.Hour), env.now().Add(time.Hour))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != 1 {
+				t.Fatalf("%+v", records)
+			}
+			r := records[0]
+			if r.Kind != auditAutoApprove || r.Decision != c.wantDecision || r.Reasons[0] != c.wantReason || r.Sha != "abc" || r.PullRequest != 1 {
+				t.Fatalf("%+v", r)
+			}
+			if (len(r.Actions) == 1) != c.wantApprove {
+				t.Fatalf("%+v", r.Actions)
+			}
+		})
+	}
+}
+
+func TestAutoApproveDisabled(t *testing.T) {
+	store := newMemoryStore()
+	k := &checker{store: store}
+	run := &github.WorkflowRun{ID: github.Int64(2)}
+	if err := k.autoApprove(context.Background(), &queueMessage{}, run, &github.Workflow{}, guard.DefaultPolicy(), []int{1}); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := store.list(context.Background(), "audit/")
+	if err != nil || len(keys) != 0 {
+		t.Fatalf("%v %v", keys, err)
+	}
+}
@@ -50,7 +50,7 @@ func newAzblobCredential(s string) (*azblob.SharedKeyCredential, error) {
 const defaultContainerTemplate = "https://%s.blob.core.windows.net/%s"
 
 func ensureContainer(context context.Context, env env, cred *azblob.SharedKeyCredential, container string) (*azblob.ContainerURL, error) {
-	urlTemplate := env.containerTemplate()
+	urlTemplate := env.config().ContainerTemplate
 	if urlTemplate == nil {
 		t := defaultContainerTemplate
 		urlTemplate = &t
@@ -70,20 +70,10 @@ func TestNewAzblobCredentialWithIncorrectKey(t *testing.T) {
 	}
 }
 
-type TestContaienrEnv struct {
-	env
-	template string
-}
-
-func (t *TestContaienrEnv) containerTemplate() *string {
-	return &t.template
-}
-
-func newTestContainerEnv(s string) TestContaienrEnv {
-	return TestContaienrEnv{
-		env:      newEnv(),
-		template: s,
-	}
+func newTestContainerEnv(s string) env {
+	conf := defaultConfig()
+	conf.ContainerTemplate = &s
+	return newEnv(conf)
 }
 
 func TestEnsureContainer(t *testing.T) {
@@ -97,7 +87,7 @@ func TestEnsureContainer(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	url, err := ensureContainer(context.Background(), &env, cred, "container")
+	url, err := ensureContainer(context.Background(), env, cred, "container")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -118,7 +108,7 @@ func TestEnsureContainerAlreadyExists(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	_, err = ensureContainer(context.Background(), &env, cred, "container")
+	_, err = ensureContainer(context.Background(), env, cred, "container")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -136,7 +126,7 @@ func TestEnsureContainerOtherError(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	_, err = ensureContainer(context.Background(), &env, cred, "container")
+	_, err = ensureContainer(context.Background(), env, cred, "container")
 	if err == nil {
 		t.Fail()
 	}
@@ -148,7 +138,7 @@ func TestEnsureContainerInvalidURL(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	_, err = ensureContainer(context.Background(), &env, cred, "container")
+	_, err = ensureContainer(context.Background(), env, cred, "container")
 	if err == nil {
 		t.Fail()
 	}
@@ -167,7 +157,7 @@ func TestNewBlobUrlWithSas(t *testing.T) {
 	}
 
 	b := conurl.NewBlobURL("test")
-	bloburl, err := newBlobUrlWithSas(newEnv(), cred, &b, 10, true, true)
+	bloburl, err := newBlobUrlWithSas(newEnv(defaultConfig()), cred, &b, 10, true, true)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -186,7 +176,7 @@ func TestNewBlobUrlWithSasNoCredential(t *testing.T) {
 	conurl := azblob.NewContainerURL(*u, azblob.NewPipeline(azblob.NewAnonymousCredential(), azblob.PipelineOptions{}))
 
 	bloburl := conurl.NewBlobURL("test")
-	_, err = newBlobUrlWithSas(newEnv(), nil, &bloburl, 10, true, true)
+	_, err = newBlobUrlWithSas(newEnv(defaultConfig()), nil, &bloburl, 10, true, true)
 	if err == nil {
 		t.Fail()
 	}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/google/go-github/v35/github"
+	"github.com/labstack/echo/v4"
+	"github.com/yskszk63/cancel-workflow-run/guard"
+)
+
+// checker checks workflow runs of pull requests, and cancels them.
+// It does not depend on the http request, so shared by process and the action.
+type checker struct {
+	client   *github.Client
+	env      env
+	store    kvStore
+	logger   echo.Logger
+	renderer echo.Renderer
+	// login is the bot user of the comments.
+	login string
+	// requested actions of check runs are only delivered to the app.
+	withoutChecks bool
+}
+
+// newChecker returns the checker from the request context.
+func newChecker(c echo.Context, client *github.Client, login string) *checker {
+	return &checker{
+		client:   client,
+		env:      getEnv(c),
+		store:    getStore(c),
+		logger:   c.Echo().Logger,
+		renderer: c.Echo().Renderer,
+		login:    login,
+	}
+}
+
+// guardClient returns the client for guard, which edits comments of the bot.
+func (k *checker) guardClient() *guard.Client {
+	client := guard.NewClient(k.client)
+	client.Login = k.login
+	return client
+}
+
+func (k *checker) checkWorkflowRun(context context.Context, msg *queueMessage) error {
+	client := k.client
+
+	run, _, err := client.Actions.GetWorkflowRunByID(context, msg.Owner, msg.RepositoryName, msg.WorkflowRunId)
+	if err != nil {
+		return err
+	}
+
+	workflow, _, err := client.Actions.GetWorkflowByID(context, msg.Owner, msg.RepositoryName, run.GetWorkflowID())
+	if err != nil {
+		return err
+	}
+
+	policy, err := repoPolicies.get(context, k.env, client, msg.Owner, msg.RepositoryName)
+	if err != nil {
+		k.logger.Warnf("%s/%s: %s. fallback to default policy.", msg.Owner, msg.RepositoryName, err)
+		policy = guard.DefaultPolicy()
+	}
+	if !policy.Enabled || policy.IsExemptPath(workflow.GetPath()) {
+		return nil
+	}
+	if k.withoutChecks && policy.Actions.Check {
+		p := *policy
+		p.Actions.Check = false
+		policy = &p
+	}
+
+	pullRequestNums := msg.PullRequestNums
+	if len(pullRequestNums) == 0 {
+		pullRequestNums, err = guard.ResolvePullRequests(context, k.guardClient(), msg.Owner, msg.RepositoryName, run)
+		if err != nil {
+			return err
+		}
+	}
+
+	if guard.IsActionRequired(run) {
+		return k.autoApprove(context, msg, run, workflow, policy, pullRequestNums)
+	}
+
+	a, err := k.approveByRerun(context, msg.Owner, msg.RepositoryName, run, msg.RunAttempt, msg.TriggeringActor)
+	if err != nil {
+		return err
+	}
+	if a != nil {
+		k.recordAudit(context, &auditRecord{
+			Kind:           auditWorkflowRun,
+			InstallationId: msg.InstallationId,
+			Owner:          msg.Owner,
+			Repo:           msg.RepositoryName,
+			RunId:          run.GetID(),
+			Sha:            run.GetHeadSHA(),
+			Decision:       "approved",
+			Reasons:        []string{fmt.Sprintf("approved by %s via %s", a.By, a.Via)},
+		})
+		return k.markApproved(context, msg.Owner, msg.RepositoryName, pullRequestNums, run.GetID())
+	}
+
+	gclient := k.guardClient()
+	decider := guard.NewDecider(policy)
+	executor := &guard.Executor{
+		Client: gclient,
+		Policy: policy,
+		Render: commentRenderer(k.renderer),
+		Logger: k.logger,
+	}
+	for _, prnum := range pullRequestNums {
+		pr, _, err := client.PullRequests.Get(context, msg.Owner, msg.RepositoryName, prnum)
+		if err != nil {
+			return err
+		}
+
+		input, err := decider.Gather(context, gclient, msg.Owner, msg.RepositoryName, run, workflow, pr)
+		if err != nil {
+			return err
+		}
+		decision := decider.Decide(input)
+		record := &auditRecord{
+			Kind:           auditWorkflowRun,
+			InstallationId: msg.InstallationId,
+			Owner:          msg.Owner,
+			Repo:           msg.RepositoryName,
+			PullRequest:    pr.GetNumber(),
+			RunId:          run.GetID(),
+			Sha:            run.GetHeadSHA(),
+			Decision:       "skip",
+			DryRun:         policy.DryRun,
+		}
+		for _, f := range input.Files {
+			record.Files = append(record.Files, f.GetFilename())
+		}
+		if decision.Reason != "" {
+			record.Reasons = append(record.Reasons, decision.Reason)
+		}
+		if d := decision.Detection; d != nil {
+			k.logger.Infof("%s: score %d %v", input.Change.Filename, d.Score, d.Reasons())
+			record.Reasons = append(record.Reasons, d.Reasons()...)
+		}
+		if !decision.Cancel {
+			if decision.Reason != "" {
+				k.logger.Infof("#%d: skipped. (%s)", pr.GetNumber(), decision.Reason)
+			}
+			k.recordAudit(context, record)
+			continue
+		}
+
+		record.Decision = "cancel"
+		executor.OnAction = func(r guard.ActionResult) {
+			record.Actions = append(record.Actions, r)
+		}
+		err = executor.Execute(context, msg.Owner, msg.RepositoryName, run, pr, decision)
+		observeActions(auditWorkflowRun, run, record.Actions, k.env.now())
+		k.recordAudit(context, record)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// approveByRerun returns the approval of the run, or nil if not approved.
+// A re-run by the user who has write permission is an approval for the head sha.
+func (k *checker) approveByRerun(context context.Context, owner, repo string, run *github.WorkflowRun, attempt int, actor string) (*approval, error) {
+	a, err := findApproval(context, k.store, owner, repo, run.GetHeadSHA())
+	if err != nil {
+		return nil, err
+	}
+	if a != nil {
+		k.logger.Infof("%s: approved by %s via %s.", run.GetHeadSHA(), a.By, a.Via)
+		return a, nil
+	}
+
+	if attempt < 2 || run.GetHeadSHA() == "" {
+		return nil, nil
+	}
+	writable, err := guard.HasWritePermission(context, k.guardClient(), owner, repo, actor)
+	if err != nil || !writable {
+		return nil, err
+	}
+
+	a = &approval{
+		Sha: run.GetHeadSHA(),
+		By:  actor,
+		At:  k.env.now(),
+		Via: "re-run",
+	}
+	if err := recordApproval(context, k.store, owner, repo, a); err != nil {
+		return nil, err
+	}
+	k.logger.Infof("%s: approved by %s via %s.", a.Sha, a.By, a.Via)
+	if !k.withoutChecks {
+		if err := guard.CompleteGuardChecks(context, k.guardClient(), owner, repo, a.Sha, a.By, a.Via); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// markApproved updates the run on the bot comments, if cancelled before.
+func (k *checker) markApproved(context context.Context, owner, repo string, pullRequestNums []int, runIds ...int64) error {
+	for _, prnum := range pullRequestNums {
+		pr, _, err := k.client.PullRequests.Get(context, owner, repo, prnum)
+		if err != nil {
+			return err
+		}
+		err = guard.UpdateStickyComment(context, k.guardClient(), commentRenderer(k.renderer), owner, repo, pr, func(state *guard.StickyState) bool {
+			updated := false
+			for _, id := range runIds {
+				if state.SetStatus(id, guard.RunStatusApproved) {
+					updated = true
+				}
+			}
+			return updated
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// commentRenderer renders the bot comment by templates/comment.md.
+func commentRenderer(renderer echo.Renderer) guard.CommentRenderer {
+	return func(w io.Writer, data *guard.CommentData) error {
+		return renderer.Render(w, "comment.md", data, nil)
+	}
+}
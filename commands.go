@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v35/github"
+	"github.com/labstack/echo/v4"
+	"github.com/yskszk63/cancel-workflow-run/guard"
+)
+
+// slash commands on pull request comments.
+const (
+	commandApprove = "/approve-workflows"
+	commandDeny    = "/deny-workflows"
+)
+
+// approval via the requested action of the check run.
+const viaCheckRun = "check run"
+
+type commandMessage struct {
+	InstallationId int64  `json:"InstallationId"`
+	Owner          string `json:"Owner"`
+	RepositoryName string `json:"RepositoryName"`
+	PullRequestNum int    `json:"PullRequestNum"`
+	Command        string `json:"Command"`
+	Sender         string `json:"Sender"`
+	DeliveryId     string `json:"DeliveryId"`
+	// HeadSha is set by the check run. The pull request is resolved by it if no number.
+	HeadSha string `json:"HeadSha,omitempty"`
+	// CommentedAt is set by the comment. The head pushed after it is not approved.
+	CommentedAt  *time.Time   `json:"CommentedAt,omitempty"`
+	TraceContext traceCarrier `json:"TraceContext,omitempty"`
+}
+
+// parseCommand returns the command on the first line of the comment, or empty.
+func parseCommand(body string) string {
+	line := strings.TrimSpace(strings.SplitN(body, "\n", 2)[0])
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return ""
+	}
+	switch fields[0] {
+	case commandApprove, commandDeny:
+		return fields[0]
+	default:
+		return ""
+	}
+}
+
+func newCommandMessage(event *github.IssueCommentEvent) *commandMessage {
+	if event.GetAction() != "created" || !event.GetIssue().IsPullRequest() {
+		return nil
+	}
+	command := parseCommand(event.GetComment().GetBody())
+	if command == "" {
+		return nil
+	}
+
+	return &commandMessage{
+		InstallationId: event.GetInstallation().GetID(),
+		Owner:          event.GetRepo().GetOwner().GetLogin(),
+		RepositoryName: event.GetRepo().GetName(),
+		PullRequestNum: event.GetIssue().GetNumber(),
+		Command:        command,
+		Sender:         event.GetSender().GetLogin(),
+		CommentedAt:    event.GetComment().CreatedAt,
+	}
+}
+
+// newCheckRunCommandMessage returns the approve command by the button of the check run.
+func newCheckRunCommandMessage(event *github.CheckRunEvent) *commandMessage {
+	if event.GetAction() != "requested_action" || event.GetCheckRun().GetName() != guard.CheckName {
+		return nil
+	}
+	if event.GetRequestedAction() == nil || event.GetRequestedAction().Identifier != guard.CheckActionApprove {
+		return nil
+	}
+
+	msg := &commandMessage{
+		InstallationId: event.GetInstallation().GetID(),
+		Owner:          event.GetRepo().GetOwner().GetLogin(),
+		RepositoryName: event.GetRepo().GetName(),
+		Command:        commandApprove,
+		Sender:         event.GetSender().GetLogin(),
+		HeadSha:        event.GetCheckRun().GetHeadSHA(),
+	}
+	// pull_requests is empty if the pull request comes from a fork.
+	if prs := event.GetCheckRun().PullRequests; len(prs) > 0 {
+		msg.PullRequestNum = prs[0].GetNumber()
+	}
+	return msg
+}
+
+// approveWorkflows records the approval for the head sha, and re-runs cancelled runs.
+func approveWorkflows(c echo.Context, client *github.Client, login, owner, repo string, pr *github.PullRequest, by, via string) error {
+	sha := pr.GetHead().GetSHA()
+	a := &approval{
+		Sha: sha,
+		By:  by,
+		At:  getEnv(c).now(),
+		Via: via,
+	}
+	if err := recordApproval(c.Request().Context(), getStore(c), owner, repo, a); err != nil {
+		return err
+	}
+
+	runs, err := guard.ListRunsForSha(c.Request().Context(), guard.NewClient(client), owner, repo, pr.GetHead().GetRef(), sha, "cancelled")
+	if err != nil {
+		return err
+	}
+	for _, run := range runs {
+		if _, err := client.Actions.RerunWorkflowByID(c.Request().Context(), owner, repo, run.GetID()); err != nil {
+			return err
+		}
+		c.Echo().Logger.Infof("%s: re-run. approved by %s via %s.", run.GetHTMLURL(), by, via)
+	}
+
+	gclient := guard.NewClient(client)
+	gclient.Login = login
+	err = guard.UpdateStickyComment(c.Request().Context(), gclient, commentRenderer(c.Echo().Renderer), owner, repo, pr, func(state *guard.StickyState) bool {
+		updated := false
+		for _, r := range state.Runs {
+			if r.Status == guard.RunStatusCancelled || r.Status == guard.RunStatusFlagged {
+				r.Status = guard.RunStatusApproved
+				updated = true
+			}
+		}
+		return updated
+	})
+	if err != nil {
+		return err
+	}
+
+	return guard.CompleteGuardChecks(c.Request().Context(), guard.NewClient(client), owner, repo, sha, by, via)
+}
+
+// pushedAfter reports whether the head commit of the pull request can be pushed after the time.
+// The push is told by the runs of the commit, because the commit date is set by the author.
+// found is false if the commit has no run, so the push time is unknown.
+func pushedAfter(context context.Context, client *github.Client, owner, repo string, pr *github.PullRequest, at time.Time) (after, found bool, err error) {
+	opts := &github.ListWorkflowRunsOptions{
+		Branch:      pr.GetHead().GetRef(),
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		runs, response, err := client.Actions.ListRepositoryWorkflowRuns(context, owner, repo, opts)
+		if err != nil {
+			return false, false, err
+		}
+		older := false
+		for _, run := range runs.WorkflowRuns {
+			if !run.GetCreatedAt().After(at) {
+				older = true
+			}
+			// runs are listed newest first. the first run of the commit is the latest.
+			if run.GetHeadSHA() == pr.GetHead().GetSHA() {
+				return run.GetCreatedAt().After(at), true, nil
+			}
+		}
+		// the rest pages are older than the comment. the branch may have many runs of other pull requests.
+		if older || response.NextPage == 0 {
+			return false, false, nil
+		}
+		opts.Page = response.NextPage
+	}
+}
+
+func processCommand(c echo.Context, event *eventGridEvent) error {
+	env := getEnv(c)
+
+	msg := new(commandMessage)
+	if err := json.Unmarshal(event.Data, msg); err != nil {
+		return err
+	}
+
+	client, err := newGitHubClientAsApp(env, msg.InstallationId)
+	if err != nil {
+		return err
+	}
+	login, err := appLogin(c.Request().Context(), env)
+	if err != nil {
+		return err
+	}
+
+	writable, err := guard.HasWritePermission(c.Request().Context(), guard.NewClient(client), msg.Owner, msg.RepositoryName, msg.Sender)
+	if err != nil {
+		return err
+	}
+	if !writable {
+		c.Echo().Logger.Infof("%s/%s: %s is ignored. %s has no write permission.", msg.Owner, msg.RepositoryName, msg.Command, msg.Sender)
+		return nil
+	}
+
+	pullRequestNums := []int{msg.PullRequestNum}
+	if msg.PullRequestNum == 0 && msg.HeadSha != "" {
+		run := &github.WorkflowRun{Event: github.String("pull_request"), HeadSHA: &msg.HeadSha}
+		pullRequestNums, err = guard.ResolvePullRequests(c.Request().Context(), guard.NewClient(client), msg.Owner, msg.RepositoryName, run)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, prnum := range pullRequestNums {
+		pr, _, err := client.PullRequests.Get(c.Request().Context(), msg.Owner, msg.RepositoryName, prnum)
+		if err != nil {
+			return err
+		}
+		if err := runCommand(c, client, login, msg, pr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runCommand(c echo.Context, client *github.Client, login string, msg *commandMessage, pr *github.PullRequest) error {
+	switch msg.Command {
+	case commandApprove:
+		if msg.HeadSha == "" {
+			// the comment approves the commit the user has seen, not one pushed while the job is queued.
+			if msg.CommentedAt == nil {
+				c.Echo().Logger.Infof("#%d: %s has no comment time. approval is ignored.", pr.GetNumber(), msg.Command)
+				return nil
+			}
+			after, found, err := pushedAfter(c.Request().Context(), client, msg.Owner, msg.RepositoryName, pr, *msg.CommentedAt)
+			if err != nil {
+				return err
+			}
+			if !found {
+				c.Echo().Logger.Infof("#%d: no runs of %s are found. the push time is unknown, so approval is ignored.", pr.GetNumber(), pr.GetHead().GetSHA())
+				return nil
+			}
+			if after {
+				c.Echo().Logger.Infof("#%d: %s is pushed after the comment. approval is ignored.", pr.GetNumber(), pr.GetHead().GetSHA())
+				return nil
+			}
+			return approveWorkflows(c, client, login, msg.Owner, msg.RepositoryName, pr, msg.Sender, commandApprove)
+		}
+		// the button of the check run on an outdated commit does not approve new commits.
+		if pr.GetHead().GetSHA() != msg.HeadSha {
+			c.Echo().Logger.Infof("#%d: %s is not the head. approval is ignored.", pr.GetNumber(), msg.HeadSha)
+			return nil
+		}
+		return approveWorkflows(c, client, login, msg.Owner, msg.RepositoryName, pr, msg.Sender, viaCheckRun)
+
+	case commandDeny:
+		closed := "closed"
+		_, _, err := client.PullRequests.Edit(c.Request().Context(), msg.Owner, msg.RepositoryName, pr.GetNumber(), &github.PullRequest{State: &closed})
+		if err == nil {
+			c.Echo().Logger.Infof("#%d: closed by %s via %s.", pr.GetNumber(), msg.Sender, commandDeny)
+		}
+		return err
+
+	default:
+		c.Echo().Logger.Warnf("unknown command %s", msg.Command)
+		return nil
+	}
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v35/github"
+	"github.com/labstack/echo/v4"
+)
+
+func TestParseCommand(t *testing.T) {
+	cases := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			name: "approve",
+			body: "/approve-workflows",
+			want: commandApprove,
+		},
+		{
+			name: "deny with message",
+			body: "  /deny-workflows spam\nthanks",
+			want: commandDeny,
+		},
+		{
+			name: "not first line",
+			body: "LGTM\n/approve-workflows",
+		},
+		{
+			name: "unknown",
+			body: "/approve",
+		},
+		{
+			name: "empty",
+			body: "",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if command := parseCommand(c.body); command != c.want {
+				t.Fatal(command)
+			}
+		})
+	}
+}
+
+func TestPushedAfter(t *testing.T) {
+	cases := []struct {
+		name  string
+		pages []string
+		// wantPages is the number of pages requested.
+		wantPages int
+		wantAfter bool
+		wantFound bool
+	}{
+		{
+			name:      "pushed before",
+			pages:     []string{`[{"head_sha":"def","created_at":"2021-01-05T00:00:00Z"},{"head_sha":"abc","created_at":"2021-01-01T00:00:00Z"}]`},
+			wantPages: 1,
+			wantFound: true,
+		},
+		{
+			name:      "pushed after",
+			pages:     []string{`[{"head_sha":"abc","created_at":"2021-01-03T00:00:00Z"},{"head_sha":"abc","created_at":"2021-01-01T00:00:00Z"}]`},
+			wantPages: 1,
+			wantAfter: true,
+			wantFound: true,
+		},
+		{
+			name:      "no runs",
+			pages:     []string{`[]`},
+			wantPages: 1,
+		},
+		{
+			name: "older than the comment",
+			pages: []string{
+				`[{"head_sha":"def","created_at":"2021-01-05T00:00:00Z"},{"head_sha":"def","created_at":"2021-01-01T00:00:00Z"}]`,
+				`[{"head_sha":"abc","created_at":"2020-12-01T00:00:00Z"}]`,
+			},
+			wantPages: 1,
+		},
+		{
+			name: "next page",
+			pages: []string{
+				`[{"head_sha":"def","created_at":"2021-01-05T00:00:00Z"}]`,
+				`[{"head_sha":"abc","created_at":"2021-01-01T00:00:00Z"}]`,
+			},
+			wantPages: 2,
+			wantFound: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			requested := 0
+			var dummy *httptest.Server
+			dummy = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/api/v3/repos/o/r/actions/runs" {
+					t.Errorf("%s", r.URL)
+					w.WriteHeader(501)
+					return
+				}
+				page := requested
+				requested++
+				if page+1 < len(c.pages) {
+					w.Header().Set("Link", fmt.Sprintf(`<%s/api/v3/repos/o/r/actions/runs?page=%d>; rel="next"`, dummy.URL, page+2))
+				}
+				fmt.Fprintf(w, `{"workflow_runs":%s}`, c.pages[page])
+			}))
+			defer dummy.Close()
+
+			client := newGitHubClient(newTestEnv(dummy.URL), dummy.Client())
+			pr := &github.PullRequest{Head: &github.PullRequestBranch{SHA: github.String("abc"), Ref: github.String("main")}}
+			after, found, err := pushedAfter(context.Background(), client, "o", "r", pr, time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if after != c.wantAfter || found != c.wantFound || requested != c.wantPages {
+				t.Fatalf("%v %v %d", after, found, requested)
+			}
+		})
+	}
+}
+
+func TestProcessCommand(t *testing.T) {
+	cases := []struct {
+		name       string
+		command    string
+		permission string
+		// headSha is set by the check run. pull request is resolved by search.
+		headSha string
+		// pushedAt is the creation of the runs of the head.
+		pushedAt  string
+		wantRerun bool
+		wantClose bool
+	}{
+		{
+			name:       "approve",
+			command:    commandApprove,
+			permission: "write",
+			pushedAt:   "2021-01-01T00:00:00Z",
+			wantRerun:  true,
+		},
+		{
+			name:       "pushed after the comment",
+			command:    commandApprove,
+			permission: "write",
+			pushedAt:   "2021-01-03T00:00:00Z",
+		},
+		{
+			name:       "no runs of the head",
+			command:    commandApprove,
+			permission: "write",
+		},
+		{
+			name:       "deny",
+			command:    commandDeny,
+			permission: "admin",
+			wantClose:  true,
+		},
+		{
+			name:       "check run",
+			command:    commandApprove,
+			permission: "write",
+			headSha:    "abc",
+			wantRerun:  true,
+		},
+		{
+			name:       "check run outdated",
+			command:    commandApprove,
+			permission: "write",
+			headSha:    "old",
+		},
+		{
+			name:       "no permission",
+			command:    commandApprove,
+			permission: "read",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rerun, closed, edited, completed := false, false, false, false
+			dummy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/app/installations/0/access_tokens":
+					w.WriteHeader(200)
+					json.NewEncoder(w).Encode(github.InstallationToken{})
+				case "/api/v3/app":
+					fmt.Fprint(w, `{"slug":"app"}`)
+				case "/api/v3/repos/o/r/collaborators/maintainer/permission":
+					fmt.Fprintf(w, `{"permission":%q}`, c.permission)
+				case "/api/v3/repos/o/r/pulls/1":
+					if r.Method == http.MethodPatch {
+						closed = true
+					}
+					fmt.Fprint(w, `{"number":1,"head":{"sha":"abc","ref":"feature"}}`)
+				case "/api/v3/repos/o/r/actions/runs":
+					if r.URL.Query().Get("branch") != "feature" {
+						t.Errorf("%s", r.URL)
+					}
+					switch r.URL.Query().Get("status") {
+					case "cancelled":
+						fmt.Fprint(w, `{"total_count":2,"workflow_runs":[{"id":2,"head_sha":"abc"},{"id":3,"head_sha":"def"}]}`)
+					case "":
+						if c.pushedAt == "" {
+							fmt.Fprint(w, `{"total_count":0,"workflow_runs":[]}`)
+							break
+						}
+						fmt.Fprintf(w, `{"total_count":2,"workflow_runs":[{"id":2,"head_sha":"abc","created_at":%q},{"id":3,"head_sha":"def","created_at":"2021-01-05T00:00:00Z"}]}`, c.pushedAt)
+					default:
+						t.Errorf("%s", r.URL)
+					}
+				case "/api/v3/repos/o/r/actions/runs/2/rerun":
+					rerun = true
+					w.WriteHeader(201)
+				case "/api/v3/repos/o/r/issues/1/comments":
+					fmt.Fprint(w, `[{"id":9,"user":{"login":"app[bot]","type":"Bot"},"body":"<!-- cancel-workflow-run -->\n<!-- cancel-workflow-run:state {\"runs\":[{\"id\":2,\"status\":\"cancelled\"}]} -->"}]`)
+				case "/api/v3/repos/o/r/issues/comments/9":
+					edited = true
+					w.WriteHeader(200)
+				case "/api/v3/search/issues":
+					fmt.Fprint(w, `{"items":[{"number":1,"pull_request":{}}]}`)
+				case "/api/v3/repos/o/r/commits/abc/check-runs":
+					fmt.Fprint(w, `{"total_count":1,"check_runs":[{"id":7,"conclusion":"action_required"}]}`)
+				case "/api/v3/repos/o/r/check-runs/7":
+					completed = true
+					fmt.Fprint(w, `{"id":7}`)
+				default:
+					fmt.Printf("%s\n", r.URL)
+					w.WriteHeader(501)
+				}
+			}))
+			defer dummy.Close()
+
+			store := newMemoryStore()
+			e := echo.New()
+			e.Debug = true
+			e.Use(injectEnv(newTestEnv(dummy.URL)))
+			e.Use(injectStore(store))
+			e.Renderer = testRenderer{}
+			e.POST("/", process)
+
+			msg := commandMessage{
+				Owner:          "o",
+				RepositoryName: "r",
+				PullRequestNum: 1,
+				Command:        c.command,
+				Sender:         "maintainer",
+				HeadSha:        c.headSha,
+			}
+			if c.headSha != "" {
+				msg.PullRequestNum = 0
+			} else {
+				commentedAt := time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC)
+				msg.CommentedAt = &commentedAt
+			}
+			evt, err := newEventGridEvent("subject", eventTypeWorkflowCommand, "0", msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			j, err := json.Marshal(evt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, err := json.Marshal(invokeRequest{
+				Data: map[string]json.RawMessage{
+					"event": j,
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest("POST", "/", bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			res := httptest.NewRecorder()
+			e.ServeHTTP(res, req)
+
+			if res.Result().StatusCode != http.StatusOK {
+				t.Fatalf("%d %s", res.Result().StatusCode, res.Body.String())
+			}
+			if rerun != c.wantRerun {
+				t.Fatalf("rerun: %v", rerun)
+			}
+			if closed != c.wantClose {
+				t.Fatalf("closed: %v", closed)
+			}
+			if edited != c.wantRerun {
+				t.Fatalf("edited: %v", edited)
+			}
+			if completed != c.wantRerun {
+				t.Fatalf("completed: %v", completed)
+			}
+
+			a, err := findApproval(req.Context(), store, "o", "r", "abc")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (a != nil) != c.wantRerun {
+				t.Fatalf("%+v", a)
+			}
+		})
+	}
+}
+
+func TestNewCheckRunCommandMessage(t *testing.T) {
+	cases := []struct {
+		name    string
+		payload string
+		want    *commandMessage
+	}{
+		{
+			name: "fork",
+			payload: `{
+	"action": "requested_action",
+	"check_run": {"name": "workflow-guard", "head_sha": "abc", "pull_requests": []},
+	"requested_action": {"identifier": "approve"},
+	"repository": {"name": "r", "owner": {"login": "o"}},
+	"sender": {"login": "maintainer"}
+}`,
+			want: &commandMessage{Owner: "o", RepositoryName: "r", Command: commandApprove, Sender: "maintainer", HeadSha: "abc"},
+		},
+		{
+			name: "with pull request",
+			payload: `{
+	"action": "requested_action",
+	"check_run": {"name": "workflow-guard", "head_sha": "abc", "pull_requests": [{"number": 1}]},
+	"requested_action": {"identifier": "approve"},
+	"repository": {"name": "r", "owner": {"login": "o"}},
+	"sender": {"login": "maintainer"}
+}`,
+			want: &commandMessage{Owner: "o", RepositoryName: "r", PullRequestNum: 1, Command: commandApprove, Sender: "maintainer", HeadSha: "abc"},
+		},
+		{
+			name: "unknown action",
+			payload: `{
+	"action": "requested_action",
+	"check_run": {"name": "workflow-guard", "head_sha": "abc"},
+	"requested_action": {"identifier": "other"}
+}`,
+		},
+		{
+			name: "rerequested",
+			payload: `{
+	"action": "rerequested",
+	"check_run": {"name": "workflow-guard", "head_sha": "abc"}
+}`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			event := new(github.CheckRunEvent)
+			if err := json.Unmarshal([]byte(c.payload), event); err != nil {
+				t.Fatal(err)
+			}
+			msg := newCheckRunCommandMessage(event)
+			if !reflect.DeepEqual(msg, c.want) {
+				t.Fatalf("%+v", msg)
+			}
+		})
+	}
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// config is loaded and validated once at startup.
+type config struct {
+	Port          string
+	AppId         int64
+	WebhookSecret []byte
+	// Secret is the private key of the app in PEM.
+	Secret                  []byte
+	StorageConnectionString string
+	// GitHubBaseUrl is the url of GitHub Enterprise Server. nil is github.com.
+	GitHubBaseUrl *string
+	// ContainerTemplate formats the url of the blob container. nil is Azure.
+	ContainerTemplate *string
+	// JobQueue is the kind of the output binding in Functions mode. (eventgrid or storagequeue)
+	JobQueue       string
+	TracesExporter string
+	Log            *redactor
+}
+
+func defaultConfig() *config {
+	log, err := newRedactor(defaultLogRedaction())
+	if err != nil {
+		panic(err)
+	}
+	return &config{
+		Port:           "8080",
+		JobQueue:       jobQueueEventGrid,
+		TracesExporter: tracesExporterNone,
+		Log:            log,
+	}
+}
+
+// configError reports all problems of the configuration together.
+type configError []string
+
+func (e configError) Error() string {
+	return "incorrect configuration.\n  " + strings.Join(e, "\n  ")
+}
+
+// setting is a variable of the environment or a key of the config file.
+type setting struct {
+	name string
+	set  func(c *config, log *logRedaction, value string) error
+	// isSet reports whether the required setting is present.
+	isSet func(c *config) bool
+	// number and list accept yaml numbers and sequences in the config file.
+	// Other values must be strings so that 0123 or yes is not converted.
+	number, list bool
+}
+
+// fileValue converts the value in the config file to the same form as the env var.
+func (s setting) fileValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case int, int64, uint64, float64:
+		if s.number {
+			return fmt.Sprint(v), nil
+		}
+	case []interface{}:
+		if s.list {
+			j, err := json.Marshal(v)
+			if err != nil {
+				return "", err
+			}
+			return string(j), nil
+		}
+	}
+	return "", fmt.Errorf("not a string. quote the value")
+}
+
+func appendJsonArray(dst *[]string, value string) error {
+	var v []string
+	if err := json.Unmarshal([]byte(value), &v); err != nil {
+		return fmt.Errorf("not a json array of strings")
+	}
+	*dst = append(*dst, v...)
+	return nil
+}
+
+var settings = []setting{
+	{
+		name: "FUNCTIONS_CUSTOMHANDLER_PORT",
+		set: func(c *config, _ *logRedaction, value string) error {
+			if _, err := strconv.ParseUint(value, 10, 16); err != nil {
+				return fmt.Errorf("not a port number")
+			}
+			c.Port = value
+			return nil
+		},
+		number: true,
+	},
+	{
+		name: "APP_ID",
+		set: func(c *config, _ *logRedaction, value string) error {
+			id, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || id <= 0 {
+				return fmt.Errorf("not an app id")
+			}
+			c.AppId = id
+			return nil
+		},
+		isSet:  func(c *config) bool { return c.AppId != 0 },
+		number: true,
+	},
+	{
+		name: "WEBHOOK_SECRET",
+		set: func(c *config, _ *logRedaction, value string) error {
+			c.WebhookSecret = []byte(value)
+			return nil
+		},
+		isSet: func(c *config) bool { return len(c.WebhookSecret) > 0 },
+	},
+	{
+		name: "SECRET",
+		set: func(c *config, _ *logRedaction, value string) error {
+			secret, err := base64.StdEncoding.DecodeString(value)
+			if err != nil {
+				return fmt.Errorf("not base64")
+			}
+			if block, _ := pem.Decode(secret); block == nil {
+				return fmt.Errorf("not a base64 encoded private key in PEM")
+			}
+			c.Secret = secret
+			return nil
+		},
+		isSet: func(c *config) bool { return len(c.Secret) > 0 },
+	},
+	{
+		name: "AzureWebJobsStorage",
+		set: func(c *config, _ *logRedaction, value string) error {
+			if _, err := newAzblobCredential(value); err != nil {
+				return fmt.Errorf("not a connection string of the storage account")
+			}
+			c.StorageConnectionString = value
+			return nil
+		},
+		isSet: func(c *config) bool { return c.StorageConnectionString != "" },
+	},
+	{
+		name: "JOB_QUEUE",
+		set: func(c *config, _ *logRedaction, value string) error {
+			if _, err := newFunctionsJobQueue(value); err != nil {
+				return err
+			}
+			c.JobQueue = value
+			return nil
+		},
+	},
+	{
+		name: "OTEL_TRACES_EXPORTER",
+		set: func(c *config, _ *logRedaction, value string) error {
+			switch value {
+			case tracesExporterNone, tracesExporterOtlp, tracesExporterStdout:
+			default:
+				return fmt.Errorf("unknown traces exporter %q", value)
+			}
+			c.TracesExporter = value
+			return nil
+		},
+	},
+	{
+		name: "LOG_REDACT_PATHS",
+		set: func(_ *config, log *logRedaction, value string) error {
+			return appendJsonArray(&log.Paths, value)
+		},
+		list: true,
+	},
+	{
+		name: "LOG_REDACT_PATTERNS",
+		set: func(_ *config, log *logRedaction, value string) error {
+			return appendJsonArray(&log.Patterns, value)
+		},
+		list: true,
+	},
+	{
+		name: "LOG_BODY_MAX_SIZE",
+		set: func(_ *config, log *logRedaction, value string) error {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("not a number")
+			}
+			log.MaxSize = n
+			return nil
+		},
+		number: true,
+	},
+	{
+		name: "LOG_BODY_SAMPLE_RATE",
+		set: func(_ *config, log *logRedaction, value string) error {
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return fmt.Errorf("not a number")
+			}
+			log.SampleRate = f
+			return nil
+		},
+		number: true,
+	},
+}
+
+// readConfigFile reads the yaml or json file. Keys are same as env vars.
+func readConfigFile(name string) (map[string]interface{}, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]interface{}
+	if err := yaml.UnmarshalStrict(b, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return raw, nil
+}
+
+// loadConfig reads the file of CONFIG_FILE if present, and env vars override it.
+func loadConfig(lookupEnv func(string) (string, bool)) (*config, error) {
+	var problems configError
+
+	values := make(map[string]string)
+	if name, present := lookupEnv("CONFIG_FILE"); present && name != "" {
+		file, err := readConfigFile(name)
+		if err != nil {
+			return nil, configError{err.Error()}
+		}
+		known := make(map[string]setting, len(settings))
+		for _, s := range settings {
+			known[s.name] = s
+		}
+		keys := make([]string, 0, len(file))
+		for key := range file {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			s, ok := known[key]
+			if !ok {
+				problems = append(problems, fmt.Sprintf("%s: unknown key %s", name, key))
+				continue
+			}
+			value, err := s.fileValue(file[key])
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %s: %s", name, key, err))
+				continue
+			}
+			values[key] = value
+		}
+	}
+	for _, s := range settings {
+		if value, present := lookupEnv(s.name); present {
+			values[s.name] = value
+		}
+	}
+
+	conf := defaultConfig()
+	log := defaultLogRedaction()
+	for _, s := range settings {
+		// an empty value is same as unset. The app settings are empty until the setup is done.
+		value := values[s.name]
+		if value == "" {
+			continue
+		}
+		if err := s.set(conf, log, value); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %s", s.name, err))
+		}
+	}
+	redactor, err := newRedactor(log)
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("LOG_*: %s", err))
+	}
+	conf.Log = redactor
+
+	if len(problems) > 0 {
+		return nil, problems
+	}
+	return conf, nil
+}
+
+// settings required by each feature.
+var (
+	appSettings     = []string{"APP_ID", "WEBHOOK_SECRET", "SECRET"}
+	storageSettings = []string{"AzureWebJobsStorage"}
+)
+
+// require returns the error listing all missing settings.
+func (c *config) require(names ...string) error {
+	var problems configError
+	for _, name := range names {
+		for _, s := range settings {
+			if s.name == name && !s.isSet(c) {
+				problems = append(problems, fmt.Sprintf("no %s specified.", name))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
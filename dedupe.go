@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// deliveryLease is how long a claim blocks others.
+// The job which crashes or times out without release is retried after it.
+const deliveryLease = 10 * time.Minute
+
+// deliveryMeta is the common part of the messages to dedupe.
+type deliveryMeta struct {
+	DeliveryId string `json:"DeliveryId"`
+}
+
+// deliveryClaim is stored for the delivery. DoneAt is set once the job succeeds.
+type deliveryClaim struct {
+	ClaimedAt time.Time  `json:"claimedAt"`
+	DoneAt    *time.Time `json:"doneAt,omitempty"`
+}
+
+func deliveryKey(id string) string {
+	return "deliveries/" + id
+}
+
+// claimDelivery returns false if the delivery is done, or claimed within the lease.
+// GitHub redelivers a webhook with same X-GitHub-Delivery,
+// and Event Grid delivers an event at least once.
+func claimDelivery(context context.Context, store kvStore, id string, now time.Time) (bool, error) {
+	j, err := json.Marshal(deliveryClaim{ClaimedAt: now})
+	if err != nil {
+		return false, err
+	}
+	claimed, err := store.putIfAbsent(context, deliveryKey(id), j)
+	if err != nil || claimed {
+		return claimed, err
+	}
+
+	b, err := store.get(context, deliveryKey(id))
+	if err != nil {
+		return false, err
+	}
+	if b == nil {
+		// released meanwhile.
+		return store.putIfAbsent(context, deliveryKey(id), j)
+	}
+	existing := new(deliveryClaim)
+	if err := json.Unmarshal(b, existing); err != nil {
+		return false, err
+	}
+	if existing.DoneAt != nil || now.Before(existing.ClaimedAt.Add(deliveryLease)) {
+		return false, nil
+	}
+	// the lease is expired. a concurrent takeover can still run twice, as rare as the expiry itself.
+	if err := store.delete(context, deliveryKey(id)); err != nil {
+		return false, err
+	}
+	return store.putIfAbsent(context, deliveryKey(id), j)
+}
+
+// completeDelivery marks the delivery done, and it is never claimed again.
+func completeDelivery(context context.Context, store kvStore, id string, claimedAt, now time.Time) error {
+	j, err := json.Marshal(deliveryClaim{ClaimedAt: claimedAt, DoneAt: &now})
+	if err != nil {
+		return err
+	}
+	return store.put(context, deliveryKey(id), j)
+}
+
+// releaseDelivery allows retry of the failed delivery.
+func releaseDelivery(context context.Context, store kvStore, id string) error {
+	return store.delete(context, deliveryKey(id))
+}
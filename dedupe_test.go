@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestClaimDelivery(t *testing.T) {
+	store := newMemoryStore()
+	now := time.Unix(0, 0)
+
+	claimed, err := claimDelivery(context.Background(), store, "id", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !claimed {
+		t.Fatal("first")
+	}
+
+	claimed, err = claimDelivery(context.Background(), store, "id", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claimed {
+		t.Fatal("duplicated")
+	}
+
+	if err := releaseDelivery(context.Background(), store, "id"); err != nil {
+		t.Fatal(err)
+	}
+	claimed, err = claimDelivery(context.Background(), store, "id", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !claimed {
+		t.Fatal("released")
+	}
+
+	claimed, err = claimDelivery(context.Background(), store, "id", now.Add(deliveryLease))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !claimed {
+		t.Fatal("expired")
+	}
+
+	if err := completeDelivery(context.Background(), store, "id", now, now); err != nil {
+		t.Fatal(err)
+	}
+	claimed, err = claimDelivery(context.Background(), store, "id", now.Add(2*deliveryLease))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claimed {
+		t.Fatal("done")
+	}
+}
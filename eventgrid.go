@@ -28,3 +28,11 @@ func newEventGridEvent(subject string, eventType string, dataVersion string, dat
 		Data:        j,
 	}, nil
 }
+
+// setDeliveryId uses X-GitHub-Delivery as the event id if present.
+// A redelivered webhook has the same id.
+func (e *eventGridEvent) setDeliveryId(deliveryId string) {
+	if deliveryId != "" {
+		e.Id = deliveryId
+	}
+}
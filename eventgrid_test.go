@@ -14,3 +14,21 @@ func TestNewEventGridEvent(t *testing.T) {
 		t.Fatal(e.Data)
 	}
 }
+
+func TestEventGridEventSetDeliveryId(t *testing.T) {
+	e, err := newEventGridEvent("subject", "type", "0", "OK")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := e.Id
+	e.setDeliveryId("")
+	if e.Id != id {
+		t.Fatal(e.Id)
+	}
+
+	e.setDeliveryId("delivery")
+	if e.Id != "delivery" {
+		t.Fatal(e.Id)
+	}
+}
@@ -3,9 +3,11 @@ package main
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"sync"
 
 	"github.com/bradleyfalzon/ghinstallation"
 	"github.com/google/go-github/v35/github"
@@ -54,17 +56,20 @@ func newGitHubAppsManifest(name string, funcUrl url.URL, webhookPath string) git
 			Url: webhookUrl.String(),
 		},
 		Public:        false,
-		DefaultEvents: []string{"workflow_run"},
+		DefaultEvents: []string{"workflow_run", "workflow_job", "issue_comment", "check_run"},
 		DefaultPermissions: github.InstallationPermissions{
 			Actions:      &write,
+			Checks:       &write,
 			PullRequests: &write,
+			Issues:       &read,
+			Contents:     &read,
 			Metadata:     &read,
 		},
 	}
 }
 
 func newGitHubClient(env env, httpClient *http.Client) *github.Client {
-	if baseurl := env.gitHubBaseUrl(); baseurl != nil {
+	if baseurl := env.config().GitHubBaseUrl; baseurl != nil {
 		result, err := github.NewEnterpriseClient(*baseurl, *baseurl, httpClient)
 		if err != nil {
 			panic(err)
@@ -74,19 +79,56 @@ func newGitHubClient(env env, httpClient *http.Client) *github.Client {
 	return github.NewClient(httpClient)
 }
 
+// newGitHubClientAsApp returns the client of the installation. API calls are traced as children of the context of each call.
 func newGitHubClientAsApp(env env, installationId int64) (*github.Client, error) {
-	transport := http.DefaultTransport
-	installationTransport, err := ghinstallation.New(transport, env.appId(), installationId, env.secret())
+	conf := env.config()
+	if err := conf.require(appSettings...); err != nil {
+		return nil, err
+	}
+	transport := tracingTransport(&metricsTransport{base: http.DefaultTransport})
+	installationTransport, err := ghinstallation.New(transport, conf.AppId, installationId, conf.Secret)
 	if err != nil {
 		return nil, err
 	}
-	if url := env.gitHubBaseUrl(); url != nil {
+	if url := env.config().GitHubBaseUrl; url != nil {
 		installationTransport.BaseURL = *url
 	}
 	client := newGitHubClient(env, &http.Client{Transport: installationTransport})
 	return client, nil
 }
 
+// appLogins caches the login of the app by the app id and the url.
+var appLogins sync.Map
+
+// appLogin returns the login of the bot of the app, e.g. "app-slug[bot]".
+// The bot comments by other apps are never taken as ours.
+func appLogin(context context.Context, env env) (string, error) {
+	conf := env.config()
+	if err := conf.require(appSettings...); err != nil {
+		return "", err
+	}
+	key := fmt.Sprint(conf.AppId)
+	if url := conf.GitHubBaseUrl; url != nil {
+		key += " " + *url
+	}
+	if login, ok := appLogins.Load(key); ok {
+		return login.(string), nil
+	}
+
+	transport := tracingTransport(&metricsTransport{base: http.DefaultTransport})
+	appTransport, err := ghinstallation.NewAppsTransport(transport, conf.AppId, conf.Secret)
+	if err != nil {
+		return "", err
+	}
+	app, _, err := newGitHubClient(env, &http.Client{Transport: appTransport}).Apps.Get(context, "")
+	if err != nil {
+		return "", err
+	}
+	login := app.GetSlug() + "[bot]"
+	appLogins.Store(key, login)
+	return login, nil
+}
+
 func completeAppManifest(context context.Context, env env, query *gitHubAppsManifestResult) (*github.AppConfig, error) {
 	client := newGitHubClient(env, nil)
 	appconf, _, err := client.Apps.CompleteAppManifest(context, query.Code)
@@ -99,11 +141,14 @@ func completeAppManifest(context context.Context, env env, query *gitHubAppsMani
 
 func validatePayload(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		env := getEnv(c)
-		webhookSecret := env.webhookSecret()
+		webhookSecret := getEnv(c).config().WebhookSecret
+		if len(webhookSecret) == 0 {
+			return echo.NewHTTPError(http.StatusServiceUnavailable, "no WEBHOOK_SECRET specified.")
+		}
 
 		payload, err := github.ValidatePayload(c.Request(), webhookSecret)
 		if err != nil {
+			signatureFailures.inc()
 			return echo.NewHTTPError(http.StatusBadRequest, "signature mismatch.")
 		}
 
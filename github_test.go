@@ -30,24 +30,17 @@ func TestNewGitHubAppsManifest(t *testing.T) {
 	if manifest.HookAttrs.Url != "http://example.com/api/webhook" {
 		t.Fatal(manifest.HookAttrs.Url)
 	}
-}
-
-type testenv struct {
-	env
-	baseUrl string
-}
-
-func (e *testenv) gitHubBaseUrl() *string {
-	return &e.baseUrl
+	// the policy and workflow files are read by contents api.
+	if manifest.DefaultPermissions.GetContents() != "read" {
+		t.Fatal(manifest.DefaultPermissions)
+	}
 }
 
 func newTestenv(c *httptest.Server) env {
-	e := newEnv()
+	conf := defaultConfig()
 	url := c.URL
-	return &testenv{
-		env:     e,
-		baseUrl: url,
-	}
+	conf.GitHubBaseUrl = &url
+	return newEnv(conf)
 }
 
 func TestCompleteAppManifest(t *testing.T) {
@@ -85,15 +78,6 @@ func TestCompleteAppManifest(t *testing.T) {
 	}
 }
 
-type testValidatePayloadEnv struct {
-	env
-	wbsec string
-}
-
-func (t *testValidatePayloadEnv) webhookSecret() []byte {
-	return []byte(t.wbsec)
-}
-
 func TestValidatePayload(t *testing.T) {
 	cases := []struct {
 		name             string
@@ -116,17 +100,21 @@ func TestValidatePayload(t *testing.T) {
 			requestsignature: "sha256=xxxx",
 			status:           400,
 		},
+		{
+			name:             "not configured",
+			payload:          "empty",
+			requestsignature: "sha256=9051c49f2eed4cfe8125cba47a275e1460402ad2a4bc94d417fd1e10d9c55339",
+			status:           503,
+		},
 	}
 
 	for _, c := range cases {
 		t.Run(c.name, func(t *testing.T) {
-			env := testValidatePayloadEnv{
-				env:   &defaultEnv{},
-				wbsec: c.secret,
-			}
+			conf := defaultConfig()
+			conf.WebhookSecret = []byte(c.secret)
 
 			e := echo.New()
-			e.Use(injectEnv(&env))
+			e.Use(injectEnv(newEnv(conf)))
 			e.Use(validatePayload)
 			e.GET("/", func(c echo.Context) error {
 				return c.NoContent(http.StatusOK)
@@ -1,4 +1,4 @@
-module cancel-workflow-run
+module github.com/yskszk63/cancel-workflow-run
 
 go 1.16
 
@@ -6,14 +6,18 @@ require (
 	github.com/Azure/azure-storage-blob-go v0.13.0
 	github.com/bradleyfalzon/ghinstallation v1.1.1
 	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/google/go-cmp v0.4.0 // indirect
 	github.com/google/go-github/v35 v35.0.0
-	github.com/google/uuid v1.1.1
+	github.com/google/uuid v1.1.2
 	github.com/kr/text v0.2.0 // indirect
 	github.com/labstack/echo/v4 v4.2.2
 	github.com/labstack/gommon v0.3.0
-	github.com/stretchr/testify v1.5.1 // indirect
+	github.com/prometheus/client_golang v1.11.0
+	go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp v0.25.0
+	go.opentelemetry.io/otel v1.0.1
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.0.1
+	go.opentelemetry.io/otel/exporters/stdout/stdouttrace v1.0.1
+	go.opentelemetry.io/otel/sdk v1.0.1
+	go.opentelemetry.io/otel/trace v1.0.1
 	golang.org/x/net v0.0.0-20201021035429-f5854403a974 // indirect
-	golang.org/x/sys v0.0.0-20210119212857-b64e53b001e4 // indirect
-	gopkg.in/yaml.v2 v2.3.0 // indirect
+	gopkg.in/yaml.v2 v2.3.0
 )
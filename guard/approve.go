@@ -0,0 +1,136 @@
+package guard
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/google/go-github/v35/github"
+)
+
+// changes under this directory are never approved automatically.
+const githubDir = ".github/"
+
+// ReasonNotHead is why the run is not approved. Files of the pull request are checked at its head.
+const ReasonNotHead = "the run is not at the head of the pull request"
+
+// AutoApprovePolicy approves fork runs held in action_required.
+type AutoApprovePolicy struct {
+	Enabled bool `yaml:"enabled"`
+	// SensitivePaths are path.Match patterns. A pattern ends with / matches the directory.
+	SensitivePaths []string `yaml:"sensitive_paths"`
+}
+
+// Validate returns the error of the first invalid pattern.
+func (a *AutoApprovePolicy) Validate() error {
+	for _, pattern := range a.SensitivePaths {
+		if pattern == "" {
+			return fmt.Errorf("auto_approve.sensitive_paths: empty pattern")
+		}
+		if _, err := path.Match(strings.TrimSuffix(pattern, "/"), ""); err != nil {
+			return fmt.Errorf("auto_approve.sensitive_paths: %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// IsSensitivePath reports whether the change of the file needs a human review. Files under .github always do.
+func (a *AutoApprovePolicy) IsSensitivePath(name string) bool {
+	if strings.HasPrefix(name, githubDir) {
+		return true
+	}
+	for _, pattern := range a.SensitivePaths {
+		if strings.HasSuffix(pattern, "/") {
+			if strings.HasPrefix(name, pattern) {
+				return true
+			}
+			continue
+		}
+		// patterns are validated on load.
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// IsActionRequired reports the run waits for the approval of a maintainer.
+func IsActionRequired(run *github.WorkflowRun) bool {
+	return run.GetStatus() == "action_required" || run.GetConclusion() == "action_required"
+}
+
+// ApprovalDecision is the result of DecideAutoApprove.
+type ApprovalDecision struct {
+	Approve bool
+	// Reason is why approved, or why not.
+	Reason string
+}
+
+// GatherAutoApprove collects Input by the client to decide auto approve.
+// The changes of the workflow and files it executes are always looked into, as the cancel path does.
+func (d *Decider) GatherAutoApprove(context context.Context, client *Client, owner, repo string, run *github.WorkflowRun, workflow *github.Workflow, pr *github.PullRequest) (*Input, error) {
+	input := &Input{
+		Run:         run,
+		Workflow:    workflow,
+		PullRequest: pr,
+	}
+	files, truncated, err := ListPullRequestFiles(context, client, owner, repo, pr)
+	if err != nil {
+		return nil, err
+	}
+	input.Files = files
+	input.FilesTruncated = truncated
+
+	change, err := FindWorkflowChange(context, client, owner, repo, pr, files, workflow.GetPath(), run.GetHeadSHA())
+	if err != nil {
+		return nil, err
+	}
+	input.Change = change
+
+	executed, err := findExecutedChange(context, client, owner, repo, pr, files, workflow.GetPath())
+	if err != nil {
+		return nil, err
+	}
+	input.Executed = executed
+	return input, nil
+}
+
+// DecideAutoApprove approves if no file of the pull request is sensitive,
+// and neither the workflow nor files executed by it are changed.
+func (d *Decider) DecideAutoApprove(input *Input) *ApprovalDecision {
+	policy := &d.Policy.AutoApprove
+	if !d.Policy.Enabled || !policy.Enabled {
+		return &ApprovalDecision{Reason: "auto approve disabled"}
+	}
+	if input.FilesTruncated {
+		return &ApprovalDecision{Reason: ReasonTooManyFiles}
+	}
+	for _, file := range input.Files {
+		// renamed from the sensitive path is also sensitive.
+		for _, name := range []string{file.GetFilename(), file.GetPreviousFilename()} {
+			if name != "" && policy.IsSensitivePath(name) {
+				return &ApprovalDecision{Reason: fmt.Sprintf("sensitive path %s changed", name)}
+			}
+		}
+	}
+	if input.Change != nil {
+		return &ApprovalDecision{Reason: input.Change.Reason()}
+	}
+	if input.Executed != nil {
+		return &ApprovalDecision{Reason: input.Executed.Reason()}
+	}
+	return &ApprovalDecision{Approve: true, Reason: "no sensitive path changed"}
+}
+
+// ApproveWorkflowRunByID approves the fork run.
+// go-github does not support this endpoint yet.
+func ApproveWorkflowRunByID(context context.Context, client *Client, owner, repo string, runID int64) (*github.Response, error) {
+	u := fmt.Sprintf("repos/%v/%v/actions/runs/%v/approve", owner, repo, runID)
+	req, err := client.Raw.NewRequest(http.MethodPost, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	return client.Raw.Do(context, req, nil)
+}
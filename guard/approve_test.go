@@ -0,0 +1,155 @@
+package guard
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-github/v35/github"
+)
+
+func TestIsSensitivePath(t *testing.T) {
+	policy := &AutoApprovePolicy{SensitivePaths: []string{"scripts/", "Makefile", "*.sh"}}
+	cases := map[string]bool{
+		".github/workflows/ci.yml": true,
+		".github/CODEOWNERS":       true,
+		"scripts/build.py":         true,
+		"Makefile":                 true,
+		"build.sh":                 true,
+		"src/build.sh":             false,
+		"main.go":                  false,
+		"docs/scripts/x":           false,
+	}
+	for name, want := range cases {
+		if got := policy.IsSensitivePath(name); got != want {
+			t.Errorf("%s: %v", name, got)
+		}
+	}
+}
+
+func TestDecideAutoApprove(t *testing.T) {
+	cases := []struct {
+		name        string
+		policy      func(*Policy)
+		files       []*github.CommitFile
+		truncated   bool
+		change      *WorkflowChange
+		executed    *ExecutedChange
+		wantApprove bool
+		wantReason  string
+	}{
+		{
+			name:        "ok",
+			files:       []*github.CommitFile{{Filename: github.String("main.go")}},
+			wantApprove: true,
+			wantReason:  "no sensitive path changed",
+		},
+		{
+			name:       "disabled",
+			policy:     func(p *Policy) { p.AutoApprove.Enabled = false },
+			files:      []*github.CommitFile{{Filename: github.String("main.go")}},
+			wantReason: "auto approve disabled",
+		},
+		{
+			name:       "workflow",
+			files:      []*github.CommitFile{{Filename: github.String(".github/workflows/ci.yml")}},
+			wantReason: "sensitive path .github/workflows/ci.yml changed",
+		},
+		{
+			name:       "renamed from workflow",
+			files:      []*github.CommitFile{{Filename: github.String("ci.yml"), PreviousFilename: github.String(".github/workflows/ci.yml")}},
+			wantReason: "sensitive path .github/workflows/ci.yml changed",
+		},
+		{
+			name:       "too many files",
+			truncated:  true,
+			wantReason: ReasonTooManyFiles,
+		},
+		{
+			name:       "workflow changed",
+			files:      []*github.CommitFile{{Filename: github.String("main.go")}},
+			change:     &WorkflowChange{Status: "modified", Filename: "ci.yml"},
+			wantReason: "currently could not accept workflow modified at pull request",
+		},
+		{
+			name:       "executed file changed",
+			files:      []*github.CommitFile{{Filename: github.String("Makefile")}},
+			executed:   &ExecutedChange{Filename: "Makefile", By: ExecutedPath{Path: "Makefile", Source: "run: make test"}},
+			wantReason: "currently could not accept Makefile executed by the workflow changed at pull request (run: make test)",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			policy := DefaultPolicy()
+			policy.AutoApprove.Enabled = true
+			if c.policy != nil {
+				c.policy(policy)
+			}
+			input := &Input{Files: c.files, FilesTruncated: c.truncated, Change: c.change, Executed: c.executed}
+			decision := NewDecider(policy).DecideAutoApprove(input)
+			if decision.Approve != c.wantApprove || decision.Reason != c.wantReason {
+				t.Fatalf("%+v", decision)
+			}
+		})
+	}
+}
+
+func TestGatherAutoApprove(t *testing.T) {
+	client := &Client{
+		PullRequests: &fakePullRequests{
+			files: []*github.CommitFile{
+				{Filename: github.String("Makefile"), Status: github.String("modified")},
+			},
+		},
+		Repositories: &fakeRepositories{
+			contents: map[string]string{
+				"main:.github/workflows/ci.yml": "jobs: {test: {steps: [{run: make test}]}}",
+			},
+		},
+	}
+	workflow := &github.Workflow{Path: github.String(".github/workflows/ci.yml")}
+	pr := &github.PullRequest{
+		Head: &github.PullRequestBranch{SHA: github.String("head")},
+		Base: &github.PullRequestBranch{Ref: github.String("main")},
+	}
+
+	policy := DefaultPolicy()
+	policy.AutoApprove.Enabled = true
+	// executed files are looked into even if ignored by the cancel path.
+	policy.ExecutedFiles = DecisionIgnore
+	decider := NewDecider(policy)
+	input, err := decider.GatherAutoApprove(context.Background(), client, "o", "r", &github.WorkflowRun{HeadSHA: github.String("head")}, workflow, pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if input.Executed == nil || input.Executed.Filename != "Makefile" {
+		t.Fatalf("%+v", input)
+	}
+	if decision := decider.DecideAutoApprove(input); decision.Approve {
+		t.Fatalf("%+v", decision)
+	}
+}
+
+type recordRaw struct {
+	requests []string
+}
+
+func (f *recordRaw) NewRequest(method, urlStr string, body interface{}) (*http.Request, error) {
+	return http.NewRequest(method, urlStr, nil)
+}
+
+func (f *recordRaw) Do(ctx context.Context, req *http.Request, v interface{}) (*github.Response, error) {
+	f.requests = append(f.requests, req.Method+" "+req.URL.Path)
+	return &github.Response{Response: &http.Response{StatusCode: http.StatusCreated}}, nil
+}
+
+func TestApproveWorkflowRunByID(t *testing.T) {
+	raw := &recordRaw{}
+	if _, err := ApproveWorkflowRunByID(context.Background(), &Client{Raw: raw}, "o", "r", 1); err != nil {
+		t.Fatal(err)
+	}
+	if len(raw.requests) != 1 || raw.requests[0] != "POST repos/o/r/actions/runs/1/approve" {
+		t.Fatal(raw.requests)
+	}
+}
@@ -0,0 +1,119 @@
+package guard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/go-github/v35/github"
+)
+
+const (
+	DefaultPollInterval  = 5 * time.Second
+	DefaultCancelTimeout = 30 * time.Second
+)
+
+// CancelResult is the outcome of cancelling a run.
+type CancelResult struct {
+	// Conclusion is empty if the run is not completed yet.
+	Conclusion string
+	// Forced reports the force-cancel endpoint is used.
+	Forced bool
+	Took   time.Duration
+}
+
+// Stopped reports the run is completed.
+func (r *CancelResult) Stopped() bool {
+	return r.Conclusion != ""
+}
+
+// String describes the outcome for the bot comment. e.g. "cancelled in 3s"
+func (r *CancelResult) String() string {
+	took := r.Took.Round(time.Second)
+	switch {
+	case !r.Stopped():
+		return fmt.Sprintf("not stopped in %s", took)
+	case r.Conclusion != "cancelled":
+		return fmt.Sprintf("already completed as %s", r.Conclusion)
+	case r.Forced:
+		return fmt.Sprintf("force-cancelled in %s", took)
+	default:
+		return fmt.Sprintf("cancelled in %s", took)
+	}
+}
+
+// ForceCancelWorkflowRunByID cancels the run even if always() steps are running.
+// go-github does not support this endpoint yet.
+func ForceCancelWorkflowRunByID(context context.Context, client *Client, owner, repo string, runID int64) (*github.Response, error) {
+	u := fmt.Sprintf("repos/%v/%v/actions/runs/%v/force-cancel", owner, repo, runID)
+	req, err := client.Raw.NewRequest(http.MethodPost, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	return client.Raw.Do(context, req, nil)
+}
+
+// requested reports the cancel request is accepted.
+// 202 is AcceptedError on go-github, and 409 means the run is already completed.
+func requested(response *github.Response, err error) error {
+	if err == nil {
+		return nil
+	}
+	var accepted *github.AcceptedError
+	if errors.As(err, &accepted) {
+		return nil
+	}
+	if response != nil && response.StatusCode == http.StatusConflict {
+		return nil
+	}
+	return err
+}
+
+func (e *Executor) pollInterval() time.Duration {
+	if e.PollInterval > 0 {
+		return e.PollInterval
+	}
+	return DefaultPollInterval
+}
+
+func (e *Executor) cancelTimeout() time.Duration {
+	if e.CancelTimeout > 0 {
+		return e.CancelTimeout
+	}
+	return DefaultCancelTimeout
+}
+
+// waitCompleted polls the runs together until all completed or one deadline for them.
+// Conclusions are set to the results, and runs not completed are left empty.
+func (e *Executor) waitCompleted(context context.Context, owner, repo string, start time.Time, results map[int64]*CancelResult) error {
+	deadline := time.Now().Add(e.cancelTimeout())
+	for {
+		waiting := 0
+		for runID, result := range results {
+			if result.Stopped() {
+				continue
+			}
+			run, _, err := e.Client.Actions.GetWorkflowRunByID(context, owner, repo, runID)
+			if err != nil {
+				return err
+			}
+			if run.GetStatus() == "completed" {
+				result.Conclusion = run.GetConclusion()
+				result.Took = time.Since(start)
+				continue
+			}
+			waiting++
+		}
+		if waiting == 0 || time.Now().After(deadline) {
+			return nil
+		}
+
+		select {
+		case <-context.Done():
+			return context.Err()
+		case <-time.After(e.pollInterval()):
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package guard
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v35/github"
+)
+
+func TestCancelResult(t *testing.T) {
+	cases := []struct {
+		result CancelResult
+		want   string
+	}{
+		{result: CancelResult{Conclusion: "cancelled", Took: 3 * time.Second}, want: "cancelled in 3s"},
+		{result: CancelResult{Conclusion: "cancelled", Forced: true, Took: time.Minute}, want: "force-cancelled in 1m0s"},
+		{result: CancelResult{Conclusion: "success"}, want: "already completed as success"},
+		{result: CancelResult{Took: time.Minute}, want: "not stopped in 1m0s"},
+	}
+
+	for _, c := range cases {
+		if got := c.result.String(); got != c.want {
+			t.Fatal(got)
+		}
+	}
+}
+
+func TestRequested(t *testing.T) {
+	conflict := &github.Response{Response: &http.Response{StatusCode: http.StatusConflict}}
+	forbidden := &github.Response{Response: &http.Response{StatusCode: http.StatusForbidden}}
+
+	if err := requested(&github.Response{}, &github.AcceptedError{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := requested(conflict, &github.ErrorResponse{Response: conflict.Response}); err != nil {
+		t.Fatal(err)
+	}
+	if err := requested(forbidden, &github.ErrorResponse{Response: forbidden.Response}); err == nil {
+		t.Fatal("must be error")
+	}
+}
@@ -0,0 +1,211 @@
+package guard
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v35/github"
+)
+
+// check run on the head sha of blocked pull requests.
+const (
+	CheckName = "workflow-guard"
+	// CheckActionApprove is the identifier of the requested action.
+	CheckActionApprove = "approve"
+)
+
+// the blocks and runs are kept in the summary as hidden json, same as the bot comment.
+const (
+	checkStatePrefix = "<!-- workflow-guard:state "
+	checkStateSuffix = " -->"
+)
+
+// CheckBlock is a workflow file and the reason it blocked the runs.
+type CheckBlock struct {
+	Workflow string `json:"workflow"`
+	Reason   string `json:"reason"`
+}
+
+// checkState accumulates the decisions on the same sha.
+type checkState struct {
+	Blocks []*CheckBlock `json:"blocks"`
+	StickyState
+}
+
+func (s *checkState) upsertBlock(block *CheckBlock) {
+	for i, b := range s.Blocks {
+		if b.Workflow == block.Workflow {
+			s.Blocks[i] = block
+			return
+		}
+	}
+	s.Blocks = append(s.Blocks, block)
+}
+
+// parseCheckState returns the empty state if the summary has no state.
+func parseCheckState(summary string) *checkState {
+	state := new(checkState)
+	// the real state is always last. workflow names above it may contain a fake one.
+	start := strings.LastIndex(summary, checkStatePrefix)
+	if start < 0 {
+		return state
+	}
+	rest := summary[start+len(checkStatePrefix):]
+	end := strings.Index(rest, checkStateSuffix)
+	if end < 0 {
+		return state
+	}
+	if err := json.Unmarshal([]byte(rest[:end]), state); err != nil {
+		return new(checkState)
+	}
+	return state
+}
+
+func checkSummary(state *checkState) (string, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Workflow runs of this pull request are blocked.\n\n")
+	for _, block := range state.Blocks {
+		fmt.Fprintf(&b, "- `%s`: %s\n", block.Workflow, block.Reason)
+	}
+	fmt.Fprintf(&b, "\n| Workflow run | Status |\n| --- | --- |\n")
+	for _, entry := range state.Runs {
+		status := entry.Status
+		if entry.Outcome != "" {
+			status = fmt.Sprintf("%s (%s)", status, entry.Outcome)
+		}
+		fmt.Fprintf(&b, "| [%s](%s) | %s |\n", entry.Name, entry.Url, status)
+	}
+	fmt.Fprintf(&b, "\nUsers with write permission can approve the workflows by the button above.\n")
+
+	// json.Marshal escapes '>', so never closes the html comment.
+	j, err := json.Marshal(state)
+	if err != nil {
+		return "", err
+	}
+	b.WriteString("\n" + checkStatePrefix + string(j) + checkStateSuffix + "\n")
+	return b.String(), nil
+}
+
+// findGuardCheck returns the check run of the sha requiring the action, or nil.
+func findGuardCheck(context context.Context, client *Client, owner, repo, sha string) (*github.CheckRun, error) {
+	opts := &github.ListCheckRunsOptions{
+		CheckName:   github.String(CheckName),
+		Filter:      github.String("all"),
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		result, response, err := client.Checks.ListCheckRunsForRef(context, owner, repo, sha, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, check := range result.CheckRuns {
+			if check.GetConclusion() == "action_required" {
+				return check, nil
+			}
+		}
+		if response.NextPage == 0 {
+			return nil, nil
+		}
+		opts.Page = response.NextPage
+	}
+}
+
+// UpsertGuardCheck creates the check run requires an action to approve,
+// or updates the existing one of the sha. Returns true if created.
+// The workflow and entries are added to the ones already on the check run.
+func UpsertGuardCheck(context context.Context, client *Client, owner, repo, sha, workflow, reason string, entries []*RunEntry) (*github.CheckRun, bool, error) {
+	existing, err := findGuardCheck(context, client, owner, repo, sha)
+	if err != nil {
+		return nil, false, err
+	}
+
+	state := new(checkState)
+	if existing != nil {
+		state = parseCheckState(existing.GetOutput().GetSummary())
+	}
+	state.upsertBlock(&CheckBlock{Workflow: workflow, Reason: reason})
+	for _, entry := range entries {
+		state.Upsert(entry)
+	}
+	summary, err := checkSummary(state)
+	if err != nil {
+		return nil, false, err
+	}
+
+	now := github.Timestamp{Time: time.Now()}
+	output := &github.CheckRunOutput{
+		Title:   github.String("Workflow runs are blocked"),
+		Summary: github.String(summary),
+	}
+	actions := []*github.CheckRunAction{
+		{
+			Label:       "Approve workflows",
+			Description: "Approve and re-run cancelled workflows.",
+			Identifier:  CheckActionApprove,
+		},
+	}
+
+	if existing != nil {
+		check, _, err := client.Checks.UpdateCheckRun(context, owner, repo, existing.GetID(), github.UpdateCheckRunOptions{
+			Name:        CheckName,
+			Status:      github.String("completed"),
+			Conclusion:  github.String("action_required"),
+			CompletedAt: &now,
+			Output:      output,
+			Actions:     actions,
+		})
+		return check, false, err
+	}
+
+	check, _, err := client.Checks.CreateCheckRun(context, owner, repo, github.CreateCheckRunOptions{
+		Name:        CheckName,
+		HeadSHA:     sha,
+		Status:      github.String("completed"),
+		Conclusion:  github.String("action_required"),
+		CompletedAt: &now,
+		Output:      output,
+		Actions:     actions,
+	})
+	return check, true, err
+}
+
+// CompleteGuardChecks marks check runs of the head sha requiring the action as success.
+func CompleteGuardChecks(context context.Context, client *Client, owner, repo, sha, by, via string) error {
+	opts := &github.ListCheckRunsOptions{
+		CheckName:   github.String(CheckName),
+		Filter:      github.String("all"),
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		result, response, err := client.Checks.ListCheckRunsForRef(context, owner, repo, sha, opts)
+		if err != nil {
+			return err
+		}
+		for _, check := range result.CheckRuns {
+			if check.GetConclusion() != "action_required" {
+				continue
+			}
+			now := github.Timestamp{Time: time.Now()}
+			_, _, err := client.Checks.UpdateCheckRun(context, owner, repo, check.GetID(), github.UpdateCheckRunOptions{
+				Name:        CheckName,
+				Status:      github.String("completed"),
+				Conclusion:  github.String("success"),
+				CompletedAt: &now,
+				Output: &github.CheckRunOutput{
+					Title:   github.String("Workflow runs are approved"),
+					Summary: github.String(fmt.Sprintf("Approved by @%s via %s.", by, via)),
+				},
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if response.NextPage == 0 {
+			return nil
+		}
+		opts.Page = response.NextPage
+	}
+}
@@ -0,0 +1,99 @@
+package guard
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v35/github"
+)
+
+func TestCheckSummary(t *testing.T) {
+	state := &checkState{
+		Blocks: []*CheckBlock{{Workflow: ".github/workflows/ci.yml", Reason: "reason"}},
+		StickyState: StickyState{
+			Runs: []*RunEntry{
+				{Id: 1, Name: "ci", Url: "https://example.com/1", Status: RunStatusCancelled, Outcome: "cancelled in 1s"},
+				{Id: 2, Name: "lint", Url: "https://example.com/2", Status: RunStatusFlagged},
+			},
+		},
+	}
+	summary, err := checkSummary(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"- `.github/workflows/ci.yml`: reason\n",
+		"| [ci](https://example.com/1) | cancelled (cancelled in 1s) |\n",
+		"| [lint](https://example.com/2) | flagged |\n",
+	} {
+		if !strings.Contains(summary, want) {
+			t.Fatalf("%q not in %s", want, summary)
+		}
+	}
+	if parsed := parseCheckState(summary); !reflect.DeepEqual(parsed, state) {
+		t.Fatalf("%+v", parsed)
+	}
+}
+
+func TestUpsertGuardCheck(t *testing.T) {
+	summary, err := checkSummary(&checkState{
+		Blocks:      []*CheckBlock{{Workflow: "miner.yml", Reason: "added"}},
+		StickyState: StickyState{Runs: []*RunEntry{{Id: 1, Name: "miner", Status: RunStatusCancelled}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checks := &fakeChecks{
+		runs: map[string][]*github.CheckRun{
+			"sha": {
+				{ID: github.Int64(1), Conclusion: github.String("success")},
+				{ID: github.Int64(2), Conclusion: github.String("action_required"), Output: &github.CheckRunOutput{Summary: &summary}},
+			},
+		},
+	}
+	client := &Client{Checks: checks}
+
+	check, created, err := UpsertGuardCheck(context.Background(), client, "o", "r", "sha", "ci.yml", "executed", []*RunEntry{{Id: 2, Name: "ci", Status: RunStatusCancelled}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created || check.GetID() != 2 || len(checks.created) != 0 || !reflect.DeepEqual(checks.updated, []int64{2}) {
+		t.Fatalf("%v %+v %+v", created, checks.created, checks.updated)
+	}
+	// the block of the previous decision is kept.
+	updated := checks.outputs[0].GetSummary()
+	for _, want := range []string{"- `miner.yml`: added\n", "- `ci.yml`: executed\n", "| [miner]() |", "| [ci]() |"} {
+		if !strings.Contains(updated, want) {
+			t.Fatalf("%q not in %s", want, updated)
+		}
+	}
+
+	_, created, err = UpsertGuardCheck(context.Background(), client, "o", "r", "new", "ci.yml", "reason", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !created || len(checks.created) != 1 || checks.created[0].HeadSHA != "new" {
+		t.Fatalf("%v %+v", created, checks.created)
+	}
+}
+
+func TestCompleteGuardChecks(t *testing.T) {
+	checks := &fakeChecks{
+		runs: map[string][]*github.CheckRun{
+			"sha": {
+				{ID: github.Int64(1), Conclusion: github.String("action_required")},
+				{ID: github.Int64(2), Conclusion: github.String("success")},
+				{ID: github.Int64(3), Conclusion: github.String("action_required")},
+			},
+		},
+	}
+	err := CompleteGuardChecks(context.Background(), &Client{Checks: checks}, "o", "r", "sha", "maintainer", "/approve-workflows")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(checks.updated, []int64{1, 3}) {
+		t.Fatal(checks.updated)
+	}
+}
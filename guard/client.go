@@ -0,0 +1,79 @@
+package guard
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/go-github/v35/github"
+)
+
+// ActionsService is the subset of github.ActionsService.
+type ActionsService interface {
+	CancelWorkflowRunByID(ctx context.Context, owner, repo string, runID int64) (*github.Response, error)
+	GetWorkflowRunByID(ctx context.Context, owner, repo string, runID int64) (*github.WorkflowRun, *github.Response, error)
+	ListRepositoryWorkflowRuns(ctx context.Context, owner, repo string, opts *github.ListWorkflowRunsOptions) (*github.WorkflowRuns, *github.Response, error)
+}
+
+// IssuesService is the subset of github.IssuesService.
+type IssuesService interface {
+	ListComments(ctx context.Context, owner, repo string, number int, opts *github.IssueListCommentsOptions) ([]*github.IssueComment, *github.Response, error)
+	CreateComment(ctx context.Context, owner, repo string, number int, comment *github.IssueComment) (*github.IssueComment, *github.Response, error)
+	EditComment(ctx context.Context, owner, repo string, commentID int64, comment *github.IssueComment) (*github.IssueComment, *github.Response, error)
+}
+
+// PullRequestsService is the subset of github.PullRequestsService.
+type PullRequestsService interface {
+	List(ctx context.Context, owner, repo string, opts *github.PullRequestListOptions) ([]*github.PullRequest, *github.Response, error)
+	ListFiles(ctx context.Context, owner, repo string, number int, opts *github.ListOptions) ([]*github.CommitFile, *github.Response, error)
+}
+
+// RepositoriesService is the subset of github.RepositoriesService.
+type RepositoriesService interface {
+	GetContents(ctx context.Context, owner, repo, path string, opts *github.RepositoryContentGetOptions) (*github.RepositoryContent, []*github.RepositoryContent, *github.Response, error)
+	GetPermissionLevel(ctx context.Context, owner, repo, user string) (*github.RepositoryPermissionLevel, *github.Response, error)
+}
+
+// ChecksService is the subset of github.ChecksService.
+type ChecksService interface {
+	CreateCheckRun(ctx context.Context, owner, repo string, opts github.CreateCheckRunOptions) (*github.CheckRun, *github.Response, error)
+	UpdateCheckRun(ctx context.Context, owner, repo string, checkRunID int64, opts github.UpdateCheckRunOptions) (*github.CheckRun, *github.Response, error)
+	ListCheckRunsForRef(ctx context.Context, owner, repo, ref string, opts *github.ListCheckRunsOptions) (*github.ListCheckRunsResults, *github.Response, error)
+}
+
+// SearchService is the subset of github.SearchService.
+type SearchService interface {
+	Issues(ctx context.Context, query string, opts *github.SearchOptions) (*github.IssuesSearchResult, *github.Response, error)
+}
+
+// RawService sends requests to endpoints go-github does not support. *github.Client satisfies it.
+type RawService interface {
+	NewRequest(method, urlStr string, body interface{}) (*http.Request, error)
+	Do(ctx context.Context, req *http.Request, v interface{}) (*github.Response, error)
+}
+
+// Client is the GitHub API used by this package.
+// Each service can be replaced, e.g. by a fake in tests.
+type Client struct {
+	Actions      ActionsService
+	Checks       ChecksService
+	Issues       IssuesService
+	PullRequests PullRequestsService
+	Repositories RepositoriesService
+	Search       SearchService
+	Raw          RawService
+	// Login is the user of the bot, e.g. "app-slug[bot]". Only its comments are edited.
+	Login string
+}
+
+// NewClient adapts go-github client.
+func NewClient(client *github.Client) *Client {
+	return &Client{
+		Actions:      client.Actions,
+		Checks:       client.Checks,
+		Issues:       client.Issues,
+		PullRequests: client.PullRequests,
+		Repositories: client.Repositories,
+		Search:       client.Search,
+		Raw:          client,
+	}
+}
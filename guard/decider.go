@@ -0,0 +1,157 @@
+package guard
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-github/v35/github"
+)
+
+const (
+	ReasonAddedWorkflow  = "currently could not accept added at pull request"
+	ReasonTooManyFiles   = "pull request has too many changed files to check"
+	ReasonMissingContent = "workflow content not found at the run"
+)
+
+// Input is a workflow run and its pull request to decide.
+type Input struct {
+	Run         *github.WorkflowRun
+	Workflow    *github.Workflow
+	PullRequest *github.PullRequest
+	Files       []*github.CommitFile
+	// FilesTruncated reports the pull request has more files than listed.
+	FilesTruncated bool
+	// Change is the change of the workflow file of the run. nil if not changed.
+	Change *WorkflowChange
+	// Executed is the change of the file run by the workflow. nil if not changed.
+	Executed *ExecutedChange
+	// Trusted is why the pull request author is trusted. Empty if not trusted.
+	Trusted string
+}
+
+// Decision is the result of Decider.
+type Decision struct {
+	Cancel bool
+	// Reason is why cancelled, or why skipped.
+	Reason string
+	// Detection is nil if the change is not analyzed.
+	Detection *Detection
+	// Workflow is the path of the workflow file of the run.
+	Workflow string
+}
+
+// Decider decides whether the workflow run is cancelled by the policy.
+type Decider struct {
+	Policy    *Policy
+	Detectors []Detector
+}
+
+// NewDecider returns the decider with the default detectors.
+func NewDecider(policy *Policy) *Decider {
+	return &Decider{
+		Policy:    policy,
+		Detectors: DefaultDetectors,
+	}
+}
+
+// exempted returns why the input is exempted, or empty.
+func (d *Decider) exempted(input *Input) string {
+	switch {
+	case !d.Policy.Enabled:
+		return "disabled"
+	case d.Policy.IsExemptPath(input.Workflow.GetPath()):
+		return "exempt path"
+	case d.Policy.IsExemptUser(input.PullRequest.GetUser().GetLogin()):
+		return "exempt user"
+	default:
+		return ""
+	}
+}
+
+// Gather collects Input by the client.
+// Files are not listed if exempted or the author is trusted.
+func (d *Decider) Gather(context context.Context, client *Client, owner, repo string, run *github.WorkflowRun, workflow *github.Workflow, pr *github.PullRequest) (*Input, error) {
+	input := &Input{
+		Run:         run,
+		Workflow:    workflow,
+		PullRequest: pr,
+	}
+	if d.exempted(input) != "" {
+		return input, nil
+	}
+
+	trusted, why, err := d.Policy.Trust.TrustedAuthor(context, client, owner, repo, pr)
+	if err != nil {
+		return nil, err
+	}
+	if trusted {
+		input.Trusted = why
+		return input, nil
+	}
+
+	files, truncated, err := ListPullRequestFiles(context, client, owner, repo, pr)
+	if err != nil {
+		return nil, err
+	}
+	input.Files = files
+	input.FilesTruncated = truncated
+
+	change, err := FindWorkflowChange(context, client, owner, repo, pr, files, workflow.GetPath(), run.GetHeadSHA())
+	if err != nil {
+		return nil, err
+	}
+	input.Change = change
+
+	if d.Policy.ExecutedFiles != DecisionIgnore {
+		executed, err := findExecutedChange(context, client, owner, repo, pr, files, workflow.GetPath())
+		if err != nil {
+			return nil, err
+		}
+		input.Executed = executed
+	}
+	return input, nil
+}
+
+// Decide makes the decision from the input of Gather. No API is called.
+func (d *Decider) Decide(input *Input) *Decision {
+	if why := d.exempted(input); why != "" {
+		return &Decision{Reason: why}
+	}
+	if input.Trusted != "" {
+		return &Decision{Reason: fmt.Sprintf("trusted author (%s)", input.Trusted)}
+	}
+
+	decision := &Decision{Workflow: input.Workflow.GetPath()}
+	if input.FilesTruncated && d.Policy.TooManyFiles == DecisionCancel {
+		decision.Cancel = true
+		decision.Reason = ReasonTooManyFiles
+	}
+	if input.Executed != nil && d.Policy.ExecutedFiles == DecisionCancel {
+		decision.Cancel = true
+		decision.Reason = input.Executed.Reason()
+	}
+
+	change := input.Change
+	if change == nil {
+		return decision
+	}
+	switch d.Policy.Statuses.ForStatus(change.Status) {
+	case DecisionCancel:
+		decision.Cancel = true
+		decision.Reason = change.Reason()
+	case DecisionAnalyze:
+		if change.Head == nil {
+			// nothing to analyze. the run executes unknown content.
+			decision.Cancel = true
+			decision.Reason = fmt.Sprintf("%s (%s)", change.Reason(), ReasonMissingContent)
+			return decision
+		}
+		detection := AnalyzeWorkflowChange(change.Head, change.Base, d.Detectors)
+		decision.Detection = detection
+		if detection.Score >= d.Policy.Threshold {
+			decision.Cancel = true
+			decision.Reason = fmt.Sprintf("%s (%s)", change.Reason(), FormatReasons(detection.Reasons()))
+		}
+	}
+	return decision
+}
@@ -0,0 +1,196 @@
+package guard
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-github/v35/github"
+)
+
+type fakePullRequests struct {
+	PullRequestsService
+	files []*github.CommitFile
+}
+
+func (f *fakePullRequests) ListFiles(ctx context.Context, owner, repo string, number int, opts *github.ListOptions) ([]*github.CommitFile, *github.Response, error) {
+	return f.files, &github.Response{}, nil
+}
+
+type fakeRepositories struct {
+	RepositoriesService
+	// ref:path -> content
+	contents   map[string]string
+	permission string
+}
+
+func (f *fakeRepositories) GetContents(ctx context.Context, owner, repo, path string, opts *github.RepositoryContentGetOptions) (*github.RepositoryContent, []*github.RepositoryContent, *github.Response, error) {
+	// no options reads the default branch.
+	ref := ""
+	if opts != nil {
+		ref = opts.Ref
+	}
+	content, exists := f.contents[ref+":"+path]
+	if !exists {
+		response := &github.Response{Response: &http.Response{StatusCode: http.StatusNotFound}}
+		return nil, nil, response, &github.ErrorResponse{Response: response.Response}
+	}
+	encoding := "base64"
+	encoded := base64.StdEncoding.EncodeToString([]byte(content))
+	return &github.RepositoryContent{Encoding: &encoding, Content: &encoded}, nil, &github.Response{}, nil
+}
+
+func (f *fakeRepositories) GetPermissionLevel(ctx context.Context, owner, repo, user string) (*github.RepositoryPermissionLevel, *github.Response, error) {
+	return &github.RepositoryPermissionLevel{Permission: &f.permission}, &github.Response{}, nil
+}
+
+func TestDecide(t *testing.T) {
+	miner := []byte("on: pull_request\njobs:\n  a:\n    steps:\n      - run: ./xmrig\n")
+
+	cases := []struct {
+		name       string
+		policy     func(*Policy)
+		author     string
+		input      Input
+		wantCancel bool
+		wantReason string
+	}{
+		{
+			name:  "not changed",
+			input: Input{},
+		},
+		{
+			name:       "added",
+			input:      Input{Change: &WorkflowChange{Status: "added"}},
+			wantCancel: true,
+			wantReason: ReasonAddedWorkflow,
+		},
+		{
+			name:       "analyzed",
+			input:      Input{Change: &WorkflowChange{Status: "modified", Head: miner}},
+			wantCancel: true,
+			wantReason: "currently could not accept workflow modified at pull request (known miner or mining pool found)",
+		},
+		{
+			name: "analyzed with existing installer",
+			input: Input{Change: &WorkflowChange{
+				Status: "modified",
+				Base:   []byte("jobs: {a: {steps: [{run: curl -sSf https://sh.rustup.rs | sh}]}}"),
+				Head:   []byte("jobs: {a: {steps: [{run: curl -sSf https://sh.rustup.rs | sh}, {run: cargo test}]}}"),
+			}},
+		},
+		{
+			name:       "analyzed without content",
+			input:      Input{Change: &WorkflowChange{Status: "modified", Base: []byte("on: push")}},
+			wantCancel: true,
+			wantReason: "currently could not accept workflow modified at pull request (" + ReasonMissingContent + ")",
+		},
+		{
+			name:  "analyzed and harmless",
+			input: Input{Change: &WorkflowChange{Status: "modified", Head: []byte("on: push")}},
+		},
+		{
+			name:       "too many files",
+			input:      Input{FilesTruncated: true},
+			wantCancel: true,
+			wantReason: ReasonTooManyFiles,
+		},
+		{
+			name:       "too many files ignored",
+			policy:     func(p *Policy) { p.TooManyFiles = DecisionIgnore },
+			input:      Input{FilesTruncated: true},
+			wantReason: "",
+		},
+		{
+			name:       "executed file",
+			input:      Input{Executed: &ExecutedChange{Filename: "Makefile", By: ExecutedPath{Path: "Makefile", Source: "run: make"}}},
+			wantCancel: true,
+			wantReason: "currently could not accept Makefile executed by the workflow changed at pull request (run: make)",
+		},
+		{
+			name:   "executed file ignored",
+			policy: func(p *Policy) { p.ExecutedFiles = DecisionIgnore },
+			input:  Input{Executed: &ExecutedChange{Filename: "Makefile"}},
+		},
+		{
+			name:       "disabled",
+			policy:     func(p *Policy) { p.Enabled = false },
+			input:      Input{Change: &WorkflowChange{Status: "added"}},
+			wantReason: "disabled",
+		},
+		{
+			name:       "exempt user",
+			policy:     func(p *Policy) { p.ExemptUsers = []string{"octocat"} },
+			author:     "octocat",
+			input:      Input{Change: &WorkflowChange{Status: "added"}},
+			wantReason: "exempt user",
+		},
+		{
+			name:       "trusted",
+			input:      Input{Change: &WorkflowChange{Status: "added"}, Trusted: "trusted bot"},
+			wantReason: "trusted author (trusted bot)",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			policy := DefaultPolicy()
+			if c.policy != nil {
+				c.policy(policy)
+			}
+			input := c.input
+			input.Workflow = &github.Workflow{Path: github.String(".github/workflows/ci.yml")}
+			input.PullRequest = &github.PullRequest{User: &github.User{Login: &c.author}}
+
+			decision := NewDecider(policy).Decide(&input)
+			if decision.Cancel != c.wantCancel || decision.Reason != c.wantReason {
+				t.Fatalf("%+v", decision)
+			}
+		})
+	}
+}
+
+func TestGather(t *testing.T) {
+	client := &Client{
+		PullRequests: &fakePullRequests{
+			files: []*github.CommitFile{
+				{Filename: github.String(".github/workflows/ci.yml"), Status: github.String("added")},
+			},
+		},
+		Repositories: &fakeRepositories{
+			contents: map[string]string{
+				"head:.github/workflows/ci.yml": "on: pull_request",
+			},
+			permission: "read",
+		},
+	}
+	workflow := &github.Workflow{Path: github.String(".github/workflows/ci.yml")}
+	pr := &github.PullRequest{
+		User: &github.User{Login: github.String("octocat")},
+		Head: &github.PullRequestBranch{SHA: github.String("head")},
+		Base: &github.PullRequestBranch{Ref: github.String("main")},
+	}
+
+	decider := NewDecider(DefaultPolicy())
+	input, err := decider.Gather(context.Background(), client, "o", "r", &github.WorkflowRun{}, workflow, pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if input.Trusted != "" || input.Change == nil || input.Change.Status != "added" {
+		t.Fatalf("%+v", input)
+	}
+	if decision := decider.Decide(input); !decision.Cancel {
+		t.Fatalf("%+v", decision)
+	}
+
+	// trusted authors are not looked into.
+	client.Repositories.(*fakeRepositories).permission = "write"
+	input, err = decider.Gather(context.Background(), client, "o", "r", &github.WorkflowRun{}, workflow, pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if input.Trusted == "" || input.Files != nil {
+		t.Fatalf("%+v", input)
+	}
+}
@@ -0,0 +1,270 @@
+package guard
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Finding is a suspicious pattern found in a workflow.
+type Finding struct {
+	Rule   string `json:"rule"`
+	Reason string `json:"reason"`
+	Score  int    `json:"score"`
+}
+
+// Detection is the result of analyzing a workflow.
+type Detection struct {
+	Score    int       `json:"score"`
+	Findings []Finding `json:"findings"`
+}
+
+// Reasons returns the reasons of the findings.
+func (d *Detection) Reasons() []string {
+	var result []string
+	for _, f := range d.Findings {
+		result = append(result, f.Reason)
+	}
+	return result
+}
+
+// WorkflowDocument is a parsed workflow file.
+type WorkflowDocument struct {
+	// parsed is nil if the content is not a valid yaml.
+	parsed map[interface{}]interface{}
+	// texts are all scalar strings of the workflow. e.g. run, with, env.
+	texts []string
+}
+
+// ParseWorkflowDocument never fails. The raw text is kept for an invalid yaml.
+func ParseWorkflowDocument(content []byte) *WorkflowDocument {
+	parsed := make(map[interface{}]interface{})
+	if err := yaml.Unmarshal(content, &parsed); err != nil {
+		// GitHub rejects it, but still look into raw text.
+		return &WorkflowDocument{
+			texts: []string{string(content)},
+		}
+	}
+
+	doc := &WorkflowDocument{parsed: parsed}
+	doc.collectTexts(parsed)
+	return doc
+}
+
+func (w *WorkflowDocument) collectTexts(node interface{}) {
+	switch node := node.(type) {
+	case string:
+		w.texts = append(w.texts, node)
+	case map[interface{}]interface{}:
+		for k, v := range node {
+			w.collectTexts(k)
+			w.collectTexts(v)
+		}
+	case []interface{}:
+		for _, v := range node {
+			w.collectTexts(v)
+		}
+	}
+}
+
+// Parsed returns nil if the content is not a valid yaml.
+func (w *WorkflowDocument) Parsed() map[interface{}]interface{} {
+	return w.parsed
+}
+
+// Texts returns all scalar strings of the workflow.
+func (w *WorkflowDocument) Texts() []string {
+	return w.texts
+}
+
+func (w *WorkflowDocument) jobs() map[interface{}]interface{} {
+	jobs, _ := w.parsed["jobs"].(map[interface{}]interface{})
+	return jobs
+}
+
+// Detector finds suspicious patterns in a workflow.
+type Detector interface {
+	Detect(doc *WorkflowDocument) []Finding
+}
+
+type patternDetector struct {
+	rule    string
+	reason  string
+	score   int
+	pattern *regexp.Regexp
+}
+
+// patterns are matched line by line, so only added lines are analyzed on a change.
+func (p *patternDetector) textual() bool {
+	return true
+}
+
+func (p *patternDetector) Detect(doc *WorkflowDocument) []Finding {
+	for _, text := range doc.texts {
+		if p.pattern.MatchString(text) {
+			return []Finding{{Rule: p.rule, Reason: p.reason, Score: p.score}}
+		}
+	}
+	return nil
+}
+
+type matrixDetector struct {
+	limit int
+	score int
+}
+
+func matrixSize(matrix map[interface{}]interface{}) int {
+	size := 1
+	for k, v := range matrix {
+		switch k {
+		case "include", "exclude":
+			continue
+		}
+		if values, ok := v.([]interface{}); ok {
+			size *= len(values)
+		}
+	}
+	if include, ok := matrix["include"].([]interface{}); ok {
+		size += len(include)
+	}
+	return size
+}
+
+func (m *matrixDetector) Detect(doc *WorkflowDocument) []Finding {
+	for name, job := range doc.jobs() {
+		job, _ := job.(map[interface{}]interface{})
+		strategy, _ := job["strategy"].(map[interface{}]interface{})
+		// matrix may be an expression. e.g. ${{ fromJSON(...) }}
+		matrix, ok := strategy["matrix"].(map[interface{}]interface{})
+		if !ok {
+			continue
+		}
+		if size := matrixSize(matrix); size > m.limit {
+			return []Finding{{
+				Rule:   "huge-matrix",
+				Reason: fmt.Sprintf("job %v has a huge matrix (%d jobs)", name, size),
+				Score:  m.score,
+			}}
+		}
+	}
+	return nil
+}
+
+var DefaultDetectors = []Detector{
+	&patternDetector{
+		rule:    "miner",
+		reason:  "known miner or mining pool found",
+		score:   100,
+		pattern: regexp.MustCompile(`(?i)xmrig|stratum\+(tcp|ssl|tls)://|cpuminer|minerd|nicehash|nanopool|2miners|ethminer|t-rex`),
+	},
+	&patternDetector{
+		rule:    "pipe-to-shell",
+		reason:  "remote script piped to shell",
+		score:   50,
+		pattern: regexp.MustCompile(`(curl|wget)\s[^\n|;&]*\|\s*(sudo\s+)?(ba|z|da)?sh\b`),
+	},
+	&patternDetector{
+		rule:    "base64-payload",
+		reason:  "base64 decoded payload",
+		score:   40,
+		pattern: regexp.MustCompile(`base64\s+(-d|--decode|-D)\b|\bb64decode\b|FromBase64String`),
+	},
+	&patternDetector{
+		rule:    "background-process",
+		reason:  "background process left running",
+		score:   30,
+		pattern: regexp.MustCompile(`(?m)\bnohup\b|\bdisown\b|\bsetsid\b|[^&]&\s*$`),
+	},
+	&matrixDetector{
+		limit: 32,
+		score: 40,
+	},
+}
+
+// AnalyzeWorkflow scores the workflow content by detectors.
+func AnalyzeWorkflow(content []byte, detectors []Detector) *Detection {
+	doc := ParseWorkflowDocument(content)
+
+	result := &Detection{}
+	for _, d := range detectors {
+		for _, f := range d.Detect(doc) {
+			result.Score += f.Score
+			result.Findings = append(result.Findings, f)
+		}
+	}
+	return result
+}
+
+// textualDetector matches texts of the document. Others look into the structure.
+type textualDetector interface {
+	textual() bool
+}
+
+func splitLines(texts []string) []string {
+	var result []string
+	for _, text := range texts {
+		result = append(result, strings.Split(text, "\n")...)
+	}
+	return result
+}
+
+// addedSince returns the document of lines not in base. The structure is of w.
+func (w *WorkflowDocument) addedSince(base *WorkflowDocument) *WorkflowDocument {
+	count := make(map[string]int)
+	for _, line := range splitLines(base.texts) {
+		count[strings.TrimSpace(line)]++
+	}
+	added := &WorkflowDocument{parsed: w.parsed}
+	for _, line := range splitLines(w.texts) {
+		key := strings.TrimSpace(line)
+		if count[key] > 0 {
+			count[key]--
+			continue
+		}
+		added.texts = append(added.texts, line)
+	}
+	return added
+}
+
+// AnalyzeWorkflowChange scores only what the change introduces.
+// Texts are matched on lines not in base, and other findings also found in base are not counted.
+// base is nil if the workflow is new.
+func AnalyzeWorkflowChange(head, base []byte, detectors []Detector) *Detection {
+	if base == nil {
+		return AnalyzeWorkflow(head, detectors)
+	}
+	headDoc := ParseWorkflowDocument(head)
+	baseDoc := ParseWorkflowDocument(base)
+	added := headDoc.addedSince(baseDoc)
+
+	result := &Detection{}
+	for _, d := range detectors {
+		if t, ok := d.(textualDetector); ok && t.textual() {
+			for _, f := range d.Detect(added) {
+				result.Score += f.Score
+				result.Findings = append(result.Findings, f)
+			}
+			continue
+		}
+
+		existing := make(map[Finding]bool)
+		for _, f := range d.Detect(baseDoc) {
+			existing[f] = true
+		}
+		for _, f := range d.Detect(headDoc) {
+			if existing[f] {
+				continue
+			}
+			result.Score += f.Score
+			result.Findings = append(result.Findings, f)
+		}
+	}
+	return result
+}
+
+// FormatReasons joins the reasons for the bot comment.
+func FormatReasons(reasons []string) string {
+	return strings.Join(reasons, ", ")
+}
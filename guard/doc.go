@@ -0,0 +1,7 @@
+// Package guard decides whether a workflow run of a pull request is cancelled,
+// and cancels it, comments on the pull request and creates the check run to approve.
+//
+// Decider gathers the input from the GitHub API and decides by the Policy of the repository.
+// Executor carries out the Decision. Both use Client, so other bots can pass their own
+// github.Client, or fakes of the services in tests.
+package guard
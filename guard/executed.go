@@ -0,0 +1,225 @@
+package guard
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/google/go-github/v35/github"
+)
+
+// ExecutedPath is a file or directory of the repository executed by a workflow.
+type ExecutedPath struct {
+	Path string
+	// Dir matches all files under the directory. e.g. local actions.
+	Dir bool
+	// Source is where the workflow refers it. e.g. "run: make test"
+	Source string
+}
+
+// Matches reports whether the file of the pull request is executed.
+func (e *ExecutedPath) Matches(name string) bool {
+	if !e.Dir {
+		return name == e.Path
+	}
+	return e.Path == "" || strings.HasPrefix(name, e.Path+"/")
+}
+
+// build tools run entry points of the repository.
+var buildEntryPoints = map[string]string{
+	"make":  "Makefile",
+	"npm":   "package.json",
+	"npx":   "package.json",
+	"yarn":  "package.json",
+	"pnpm":  "package.json",
+	"bun":   "package.json",
+	"gmake": "Makefile",
+}
+
+var scriptExtensions = []string{".sh", ".bash", ".zsh", ".py", ".rb", ".pl", ".js", ".ts", ".ps1"}
+
+// repoPath cleans the path relative to the repository root. Returns empty if not a repository path.
+func repoPath(dir, name string) string {
+	if name == "" || strings.HasPrefix(name, "/") || strings.HasPrefix(name, "~") ||
+		strings.Contains(name, "$") || strings.Contains(name, "://") {
+		return ""
+	}
+	cleaned := path.Clean(path.Join(dir, name))
+	if cleaned == "." {
+		return ""
+	}
+	if strings.HasPrefix(cleaned, "../") || cleaned == ".." {
+		return ""
+	}
+	return cleaned
+}
+
+func isScript(token string) bool {
+	if strings.HasPrefix(token, "./") {
+		return true
+	}
+	for _, ext := range scriptExtensions {
+		if strings.HasSuffix(token, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+func shorten(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) > 60 {
+		return s[:57] + "..."
+	}
+	return s
+}
+
+// runPaths extracts scripts and build entry points of the run step.
+func runPaths(dir, script string) []ExecutedPath {
+	var result []ExecutedPath
+	commands := strings.FieldsFunc(script, func(r rune) bool {
+		switch r {
+		case '\n', ';', '|', '&', '(', ')', '`':
+			return true
+		}
+		return false
+	})
+	for _, command := range commands {
+		source := "run: " + shorten(command)
+		words := strings.Fields(command)
+		// skip prefixes. e.g. sudo, env assignments
+		for len(words) > 0 && (words[0] == "sudo" || words[0] == "env" || words[0] == "exec" || strings.Contains(words[0], "=")) {
+			words = words[1:]
+		}
+		if len(words) == 0 {
+			continue
+		}
+		if entry, exists := buildEntryPoints[path.Base(words[0])]; exists {
+			if p := repoPath(dir, entry); p != "" {
+				result = append(result, ExecutedPath{Path: p, Source: source})
+			}
+		}
+		for _, word := range words {
+			word = strings.Trim(word, `"'`)
+			if strings.HasPrefix(word, "-") || !isScript(word) {
+				continue
+			}
+			if p := repoPath(dir, word); p != "" {
+				result = append(result, ExecutedPath{Path: p, Source: source})
+			}
+		}
+	}
+	return result
+}
+
+// localUses returns the path of the local action or reusable workflow. e.g. uses: ./.github/actions/setup
+func localUses(uses string) (string, bool) {
+	if !strings.HasPrefix(uses, "./") {
+		return "", false
+	}
+	return repoPath("", uses), true
+}
+
+func workingDirectory(node map[interface{}]interface{}) (string, bool) {
+	dir, ok := node["working-directory"].(string)
+	return dir, ok
+}
+
+// ExecutedPaths returns local actions, reusable workflows, scripts and build entry points run by the workflow.
+func (w *WorkflowDocument) ExecutedPaths() []ExecutedPath {
+	var result []ExecutedPath
+	seen := make(map[string]bool)
+	add := func(paths ...ExecutedPath) {
+		for _, p := range paths {
+			if !seen[p.Path] {
+				seen[p.Path] = true
+				result = append(result, p)
+			}
+		}
+	}
+
+	defaultDir := ""
+	if defaults, ok := w.parsed["defaults"].(map[interface{}]interface{}); ok {
+		if run, ok := defaults["run"].(map[interface{}]interface{}); ok {
+			defaultDir, _ = workingDirectory(run)
+		}
+	}
+
+	for _, job := range w.jobs() {
+		job, _ := job.(map[interface{}]interface{})
+		if uses, ok := job["uses"].(string); ok {
+			if p, local := localUses(uses); local {
+				add(ExecutedPath{Path: p, Source: "uses: " + uses})
+			}
+		}
+
+		jobDir := defaultDir
+		if defaults, ok := job["defaults"].(map[interface{}]interface{}); ok {
+			if run, ok := defaults["run"].(map[interface{}]interface{}); ok {
+				if dir, ok := workingDirectory(run); ok {
+					jobDir = dir
+				}
+			}
+		}
+
+		steps, _ := job["steps"].([]interface{})
+		for _, step := range steps {
+			step, _ := step.(map[interface{}]interface{})
+			if uses, ok := step["uses"].(string); ok {
+				if p, local := localUses(uses); local {
+					add(ExecutedPath{Path: p, Dir: true, Source: "uses: " + uses})
+				}
+			}
+			if run, ok := step["run"].(string); ok {
+				dir := jobDir
+				if d, ok := workingDirectory(step); ok {
+					dir = d
+				}
+				if strings.Contains(dir, "$") {
+					dir = ""
+				}
+				add(runPaths(dir, run)...)
+			}
+		}
+	}
+	return result
+}
+
+// ExecutedChange is a change of the file executed by the workflow.
+type ExecutedChange struct {
+	Filename string
+	By       ExecutedPath
+}
+
+// Reason is the reason to cancel the run.
+func (e *ExecutedChange) Reason() string {
+	return fmt.Sprintf("currently could not accept %s executed by the workflow changed at pull request (%s)", e.Filename, e.By.Source)
+}
+
+// FindExecutedChange returns nil if no file executed by the workflow is changed.
+func FindExecutedChange(files []*github.CommitFile, executed []ExecutedPath) *ExecutedChange {
+	for _, file := range files {
+		for _, name := range []string{file.GetFilename(), file.GetPreviousFilename()} {
+			if name == "" {
+				continue
+			}
+			for _, e := range executed {
+				if e.Matches(name) {
+					return &ExecutedChange{Filename: name, By: e}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// findExecutedChange looks into the workflow on the base branch.
+// The workflow on the head is not trusted, and checked by FindWorkflowChange.
+func findExecutedChange(context context.Context, client *Client, owner, repo string, pr *github.PullRequest, files []*github.CommitFile, workflowPath string) (*ExecutedChange, error) {
+	base, err := fetchContent(context, client, owner, repo, workflowPath, pr.GetBase().GetRef())
+	if err != nil || base == nil {
+		return nil, err
+	}
+	return FindExecutedChange(files, ParseWorkflowDocument(base).ExecutedPaths()), nil
+}
@@ -0,0 +1,155 @@
+package guard
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/go-github/v35/github"
+)
+
+func TestExecutedPaths(t *testing.T) {
+	cases := []struct {
+		name     string
+		workflow string
+		want     []ExecutedPath
+	}{
+		{
+			name: "local action",
+			workflow: `
+jobs:
+  test:
+    steps:
+      - uses: actions/checkout@v2
+      - uses: ./.github/actions/setup
+`,
+			want: []ExecutedPath{
+				{Path: ".github/actions/setup", Dir: true, Source: "uses: ./.github/actions/setup"},
+			},
+		},
+		{
+			name: "reusable workflow",
+			workflow: `
+jobs:
+  test:
+    uses: ./.github/workflows/test.yml
+`,
+			want: []ExecutedPath{
+				{Path: ".github/workflows/test.yml", Source: "uses: ./.github/workflows/test.yml"},
+			},
+		},
+		{
+			name: "build entry points",
+			workflow: `
+jobs:
+  test:
+    steps:
+      - run: make test
+      - run: |
+          npm ci
+          npm test
+`,
+			want: []ExecutedPath{
+				{Path: "Makefile", Source: "run: make test"},
+				{Path: "package.json", Source: "run: npm ci"},
+			},
+		},
+		{
+			name: "scripts",
+			workflow: `
+jobs:
+  test:
+    steps:
+      - run: bash scripts/test.sh && ./gradlew build
+      - run: CI=1 python tools/check.py --strict
+      - run: /usr/bin/env.sh; $HOME/x.sh
+`,
+			want: []ExecutedPath{
+				{Path: "scripts/test.sh", Source: "run: bash scripts/test.sh"},
+				{Path: "gradlew", Source: "run: ./gradlew build"},
+				{Path: "tools/check.py", Source: "run: CI=1 python tools/check.py --strict"},
+			},
+		},
+		{
+			name: "working directory",
+			workflow: `
+defaults:
+  run:
+    working-directory: web
+jobs:
+  test:
+    steps:
+      - run: yarn test
+      - run: ./run.sh
+        working-directory: scripts
+`,
+			want: []ExecutedPath{
+				{Path: "web/package.json", Source: "run: yarn test"},
+				{Path: "scripts/run.sh", Source: "run: ./run.sh"},
+			},
+		},
+		{
+			name:     "not yaml",
+			workflow: "jobs: [",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := ParseWorkflowDocument([]byte(c.workflow)).ExecutedPaths()
+			if !reflect.DeepEqual(got, c.want) {
+				t.Fatalf("%+v", got)
+			}
+		})
+	}
+}
+
+func TestFindExecutedChange(t *testing.T) {
+	executed := []ExecutedPath{
+		{Path: ".github/actions/setup", Dir: true, Source: "uses: ./.github/actions/setup"},
+		{Path: "Makefile", Source: "run: make"},
+	}
+	cases := []struct {
+		name string
+		file *github.CommitFile
+		want string
+	}{
+		{
+			name: "not executed",
+			file: &github.CommitFile{Filename: github.String("README.md")},
+		},
+		{
+			name: "file",
+			file: &github.CommitFile{Filename: github.String("Makefile")},
+			want: "Makefile",
+		},
+		{
+			name: "under the action",
+			file: &github.CommitFile{Filename: github.String(".github/actions/setup/action.yml")},
+			want: ".github/actions/setup/action.yml",
+		},
+		{
+			name: "prefix only",
+			file: &github.CommitFile{Filename: github.String(".github/actions/setup-go/action.yml")},
+		},
+		{
+			name: "renamed",
+			file: &github.CommitFile{Filename: github.String("old.mk"), PreviousFilename: github.String("Makefile")},
+			want: "Makefile",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			change := FindExecutedChange([]*github.CommitFile{c.file}, executed)
+			if c.want == "" {
+				if change != nil {
+					t.Fatalf("%+v", change)
+				}
+				return
+			}
+			if change == nil || change.Filename != c.want {
+				t.Fatalf("%+v", change)
+			}
+		})
+	}
+}
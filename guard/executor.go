@@ -0,0 +1,190 @@
+package guard
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/go-github/v35/github"
+)
+
+// Logger is satisfied by echo.Logger.
+type Logger interface {
+	Infof(format string, args ...interface{})
+}
+
+// ActionResult is an action taken by Executor, and the result of the API.
+type ActionResult struct {
+	// Action is cancel, check or comment.
+	Action string `json:"action"`
+	Target string `json:"target"`
+	Result string `json:"result,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Executor applies the decision by the policy.
+type Executor struct {
+	Client *Client
+	Policy *Policy
+	Render CommentRenderer
+	// Logger may be nil.
+	Logger Logger
+	// OnAction is called for each action taken. May be nil.
+	OnAction func(result ActionResult)
+	// PollInterval and CancelTimeout are defaults if zero.
+	PollInterval  time.Duration
+	CancelTimeout time.Duration
+}
+
+func (e *Executor) infof(format string, args ...interface{}) {
+	if e.Logger != nil {
+		e.Logger.Infof(format, args...)
+	}
+}
+
+func (e *Executor) report(action, target, result string, err error) {
+	if e.OnAction == nil {
+		return
+	}
+	r := ActionResult{Action: action, Target: target, Result: result}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	e.OnAction(r)
+}
+
+// Execute cancels the run, creates the check run and comments to the pull request.
+// Nothing is done if the decision is not to cancel.
+func (e *Executor) Execute(context context.Context, owner, repo string, run *github.WorkflowRun, pr *github.PullRequest, decision *Decision) error {
+	if !decision.Cancel {
+		return nil
+	}
+	if e.Policy.DryRun {
+		e.infof("dry run: %s would be cancelled. (%s)", run.GetHTMLURL(), decision.Reason)
+		return nil
+	}
+
+	entry := &RunEntry{
+		Id:     run.GetID(),
+		Name:   run.GetName(),
+		Url:    run.GetHTMLURL(),
+		Status: RunStatusFlagged,
+		Reason: decision.Reason,
+	}
+	entries := []*RunEntry{entry}
+	if e.Policy.Actions.Cancel {
+		siblings, err := e.findSiblings(context, owner, repo, run, pr, decision)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, siblings...)
+		if err := e.cancelEntries(context, owner, repo, entries); err != nil {
+			return err
+		}
+	}
+	if e.Policy.Actions.Check {
+		check, created, err := UpsertGuardCheck(context, e.Client, owner, repo, pr.GetHead().GetSHA(), decision.Workflow, decision.Reason, entries)
+		if err != nil {
+			e.report("check", pr.GetHead().GetSHA(), "", err)
+			return err
+		}
+		result := "updated"
+		if created {
+			result = "created"
+		}
+		e.report("check", pr.GetHead().GetSHA(), fmt.Sprintf("check run %d %s", check.GetID(), result), nil)
+		e.infof("%s: check run %d %s.", pr.GetHead().GetSHA(), check.GetID(), result)
+	}
+	if !e.Policy.Actions.Comment {
+		return nil
+	}
+
+	err := UpdateStickyComment(context, e.Client, e.Render, owner, repo, pr, func(state *StickyState) bool {
+		for _, entry := range entries {
+			state.Upsert(entry)
+		}
+		return true
+	})
+	if err != nil {
+		e.report("comment", fmt.Sprintf("#%d", pr.GetNumber()), "", err)
+		return err
+	}
+	e.report("comment", fmt.Sprintf("#%d", pr.GetNumber()), "updated", nil)
+	return nil
+}
+
+// cancelEntries requests to cancel all the runs first, and waits until they are completed together.
+// Runs ignoring the cancel, e.g. by always() steps, are force-cancelled. The outcomes are recorded to the entries.
+func (e *Executor) cancelEntries(context context.Context, owner, repo string, entries []*RunEntry) error {
+	start := time.Now()
+	results := make(map[int64]*CancelResult, len(entries))
+	for _, entry := range entries {
+		if err := requested(e.Client.Actions.CancelWorkflowRunByID(context, owner, repo, entry.Id)); err != nil {
+			e.report("cancel", entry.Url, "", err)
+			return fmt.Errorf("%s: %w", entry.Url, err)
+		}
+		results[entry.Id] = &CancelResult{}
+	}
+	if err := e.waitCompleted(context, owner, repo, start, results); err != nil {
+		return err
+	}
+
+	forced := false
+	for _, entry := range entries {
+		result := results[entry.Id]
+		if result.Stopped() {
+			continue
+		}
+		result.Forced = true
+		forced = true
+		if err := requested(ForceCancelWorkflowRunByID(context, e.Client, owner, repo, entry.Id)); err != nil {
+			e.report("cancel", entry.Url, "", err)
+			return fmt.Errorf("%s: %w", entry.Url, err)
+		}
+	}
+	if forced {
+		if err := e.waitCompleted(context, owner, repo, start, results); err != nil {
+			return err
+		}
+	}
+
+	for _, entry := range entries {
+		result := results[entry.Id]
+		if !result.Stopped() {
+			result.Took = time.Since(start)
+		}
+		e.report("cancel", entry.Url, result.String(), nil)
+		e.infof("%s: %s", entry.Url, result)
+
+		entry.Outcome = result.String()
+		if result.Conclusion == "cancelled" {
+			entry.Status = RunStatusCancelled
+		}
+	}
+	return nil
+}
+
+// findSiblings returns other queued or in progress runs of the head sha.
+// The pull request may also change scripts run by existing workflows.
+func (e *Executor) findSiblings(context context.Context, owner, repo string, run *github.WorkflowRun, pr *github.PullRequest, decision *Decision) ([]*RunEntry, error) {
+	var result []*RunEntry
+	for _, status := range []string{"queued", "in_progress"} {
+		runs, err := ListRunsForSha(context, e.Client, owner, repo, pr.GetHead().GetRef(), pr.GetHead().GetSHA(), status)
+		if err != nil {
+			return nil, err
+		}
+		for _, sibling := range runs {
+			if sibling.GetID() == run.GetID() {
+				continue
+			}
+			result = append(result, &RunEntry{
+				Id:     sibling.GetID(),
+				Name:   sibling.GetName(),
+				Url:    sibling.GetHTMLURL(),
+				Status: RunStatusFlagged,
+				Reason: decision.Reason,
+			})
+		}
+	}
+	return result, nil
+}
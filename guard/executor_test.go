@@ -0,0 +1,249 @@
+package guard
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v35/github"
+)
+
+type fakeActions struct {
+	ActionsService
+	// status -> runs
+	runs      map[string][]*github.WorkflowRun
+	cancelled []int64
+	// stubborn runs ignore cancel, e.g. always() steps.
+	stubborn bool
+	forced   bool
+	// polled is set by the first poll. cancels after it are late.
+	polled bool
+	late   bool
+}
+
+// fakeRaw serves force-cancel.
+type fakeRaw struct {
+	actions *fakeActions
+}
+
+func (f *fakeRaw) NewRequest(method, urlStr string, body interface{}) (*http.Request, error) {
+	return http.NewRequest(method, urlStr, nil)
+}
+
+func (f *fakeRaw) Do(ctx context.Context, req *http.Request, v interface{}) (*github.Response, error) {
+	if req.URL.Path != "repos/o/r/actions/runs/1/force-cancel" {
+		return nil, fmt.Errorf("unexpected %s", req.URL)
+	}
+	f.actions.forced = true
+	return &github.Response{}, nil
+}
+
+func (f *fakeActions) ListRepositoryWorkflowRuns(ctx context.Context, owner, repo string, opts *github.ListWorkflowRunsOptions) (*github.WorkflowRuns, *github.Response, error) {
+	return &github.WorkflowRuns{WorkflowRuns: f.runs[opts.Status]}, &github.Response{}, nil
+}
+
+func (f *fakeActions) CancelWorkflowRunByID(ctx context.Context, owner, repo string, runID int64) (*github.Response, error) {
+	f.cancelled = append(f.cancelled, runID)
+	f.late = f.late || f.polled
+	// go-github returns AcceptedError for 202.
+	return &github.Response{Response: &http.Response{StatusCode: http.StatusAccepted}}, &github.AcceptedError{}
+}
+
+func (f *fakeActions) GetWorkflowRunByID(ctx context.Context, owner, repo string, runID int64) (*github.WorkflowRun, *github.Response, error) {
+	f.polled = true
+	run := &github.WorkflowRun{ID: &runID, Status: github.String("in_progress")}
+	if !f.stubborn || f.forced {
+		run.Status = github.String("completed")
+		run.Conclusion = github.String("cancelled")
+	}
+	return run, &github.Response{}, nil
+}
+
+type fakeIssues struct {
+	IssuesService
+	comments []*github.IssueComment
+	created  []string
+}
+
+func (f *fakeIssues) ListComments(ctx context.Context, owner, repo string, number int, opts *github.IssueListCommentsOptions) ([]*github.IssueComment, *github.Response, error) {
+	return f.comments, &github.Response{}, nil
+}
+
+func (f *fakeIssues) CreateComment(ctx context.Context, owner, repo string, number int, comment *github.IssueComment) (*github.IssueComment, *github.Response, error) {
+	f.created = append(f.created, comment.GetBody())
+	return comment, &github.Response{}, nil
+}
+
+type fakeChecks struct {
+	ChecksService
+	created []github.CreateCheckRunOptions
+	// sha -> check runs
+	runs    map[string][]*github.CheckRun
+	updated []int64
+	outputs []*github.CheckRunOutput
+}
+
+func (f *fakeChecks) CreateCheckRun(ctx context.Context, owner, repo string, opts github.CreateCheckRunOptions) (*github.CheckRun, *github.Response, error) {
+	f.created = append(f.created, opts)
+	return &github.CheckRun{ID: github.Int64(int64(len(f.created)))}, &github.Response{}, nil
+}
+
+func (f *fakeChecks) ListCheckRunsForRef(ctx context.Context, owner, repo, ref string, opts *github.ListCheckRunsOptions) (*github.ListCheckRunsResults, *github.Response, error) {
+	return &github.ListCheckRunsResults{CheckRuns: f.runs[ref]}, &github.Response{}, nil
+}
+
+func (f *fakeChecks) UpdateCheckRun(ctx context.Context, owner, repo string, checkRunID int64, opts github.UpdateCheckRunOptions) (*github.CheckRun, *github.Response, error) {
+	f.updated = append(f.updated, checkRunID)
+	f.outputs = append(f.outputs, opts.Output)
+	return &github.CheckRun{ID: &checkRunID}, &github.Response{}, nil
+}
+
+func TestExecute(t *testing.T) {
+	cases := []struct {
+		name        string
+		policy      func(*Policy)
+		decision    Decision
+		wantCancel  []int64
+		stubborn    bool
+		wantComment bool
+		wantCheck   bool
+		wantStatus  string
+		wantOutcome string
+		wantRuns    int
+		wantActions []string
+	}{
+		{
+			name:        "cancel",
+			decision:    Decision{Cancel: true, Reason: "reason"},
+			wantCancel:  []int64{1, 2, 3},
+			wantComment: true,
+			wantCheck:   true,
+			wantStatus:  RunStatusCancelled,
+			wantOutcome: "cancelled in 0s",
+			wantRuns:    3,
+			wantActions: []string{"cancel", "cancel", "cancel", "check", "comment"},
+		},
+		{
+			name:        "force cancel",
+			stubborn:    true,
+			decision:    Decision{Cancel: true, Reason: "reason"},
+			wantCancel:  []int64{1},
+			wantComment: true,
+			wantCheck:   true,
+			wantStatus:  RunStatusCancelled,
+			wantOutcome: "force-cancelled in 0s",
+			wantRuns:    1,
+		},
+		{
+			name:     "not to cancel",
+			decision: Decision{Reason: "disabled"},
+		},
+		{
+			name:     "dry run",
+			policy:   func(p *Policy) { p.DryRun = true },
+			decision: Decision{Cancel: true, Reason: "reason"},
+		},
+		{
+			name:        "no check",
+			policy:      func(p *Policy) { p.Actions.Check = false },
+			decision:    Decision{Cancel: true, Reason: "reason"},
+			wantCancel:  []int64{1, 2, 3},
+			wantComment: true,
+			wantStatus:  RunStatusCancelled,
+			wantOutcome: "cancelled in 0s",
+			wantRuns:    3,
+		},
+		{
+			name:        "comment only",
+			policy:      func(p *Policy) { p.Actions.Cancel = false },
+			decision:    Decision{Cancel: true, Reason: "reason"},
+			wantComment: true,
+			wantCheck:   true,
+			wantStatus:  RunStatusFlagged,
+			wantRuns:    1,
+			wantActions: []string{"check", "comment"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			policy := DefaultPolicy()
+			if c.policy != nil {
+				c.policy(policy)
+			}
+			// 1 is the run itself. 9 is another sha.
+			actions := &fakeActions{
+				stubborn: c.stubborn,
+				runs: map[string][]*github.WorkflowRun{
+					"queued": {
+						{ID: github.Int64(1), HeadSHA: github.String("sha")},
+						{ID: github.Int64(2), HeadSHA: github.String("sha")},
+						{ID: github.Int64(9), HeadSHA: github.String("other")},
+					},
+					"in_progress": {
+						{ID: github.Int64(3), HeadSHA: github.String("sha")},
+					},
+				},
+			}
+			if c.stubborn {
+				actions.runs = nil
+			}
+			issues := &fakeIssues{}
+			checks := &fakeChecks{}
+			var taken []string
+			executor := &Executor{
+				OnAction:      func(r ActionResult) { taken = append(taken, r.Action) },
+				Client:        &Client{Actions: actions, Checks: checks, Issues: issues, Raw: &fakeRaw{actions: actions}},
+				Policy:        policy,
+				PollInterval:  time.Millisecond,
+				CancelTimeout: 10 * time.Millisecond,
+				Render: func(w io.Writer, data *CommentData) error {
+					_, err := fmt.Fprintf(w, "@%s", data.Opener)
+					return err
+				},
+			}
+
+			run := &github.WorkflowRun{ID: github.Int64(1)}
+			pr := &github.PullRequest{Head: &github.PullRequestBranch{SHA: github.String("sha")}}
+			err := executor.Execute(context.Background(), "o", "r", run, pr, &c.decision)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(actions.cancelled, c.wantCancel) {
+				t.Fatal(actions.cancelled)
+			}
+			if actions.late {
+				t.Fatal("polled before all cancels are requested")
+			}
+			if c.wantActions != nil && !reflect.DeepEqual(taken, c.wantActions) {
+				t.Fatal(taken)
+			}
+			if (len(checks.created) == 1) != c.wantCheck {
+				t.Fatalf("%+v", checks.created)
+			}
+			if c.wantCheck && (checks.created[0].HeadSHA != "sha" || checks.created[0].GetConclusion() != "action_required") {
+				t.Fatalf("%+v", checks.created[0])
+			}
+			if (len(issues.created) == 1) != c.wantComment {
+				t.Fatal(issues.created)
+			}
+			if !c.wantComment {
+				return
+			}
+			state := ParseStickyState(issues.created[0])
+			if state == nil || state.Runs[0].Status != c.wantStatus || state.Runs[0].Reason != "reason" {
+				t.Fatalf("%+v", state)
+			}
+			if state.Runs[0].Outcome != c.wantOutcome {
+				t.Fatalf("%+v", state.Runs[0])
+			}
+			if len(state.Runs) != c.wantRuns {
+				t.Fatalf("%+v", state.Runs)
+			}
+		})
+	}
+}
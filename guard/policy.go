@@ -0,0 +1,209 @@
+package guard
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// PolicyPath is looked up on the default branch of each repository.
+const PolicyPath = ".github/cancel-workflow-run.yml"
+
+// PolicyActions is what to do on a decision to cancel.
+type PolicyActions struct {
+	Cancel  bool `yaml:"cancel"`
+	Comment bool `yaml:"comment"`
+	// Check creates the check run to approve on the head sha.
+	Check bool `yaml:"check"`
+}
+
+// what to do for a change.
+const (
+	DecisionCancel = "cancel"
+	DecisionIgnore = "ignore"
+	// cancel if the score of detectors reaches the threshold.
+	DecisionAnalyze = "analyze"
+)
+
+// DefaultThreshold is the score to cancel on analyze.
+const DefaultThreshold = 50
+
+func validateDecision(name, value string, allowed ...string) error {
+	for _, a := range allowed {
+		if value == a {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: unknown value %q", name, value)
+}
+
+// StatusPolicies is the decision for each status of the changed workflow file.
+type StatusPolicies struct {
+	Added    string `yaml:"added"`
+	Modified string `yaml:"modified"`
+	Renamed  string `yaml:"renamed"`
+	Copied   string `yaml:"copied"`
+}
+
+// ForStatus returns the decision for the status of the file. Unknown statuses are ignored.
+func (s *StatusPolicies) ForStatus(status string) string {
+	switch status {
+	case "added":
+		return s.Added
+	case "modified", "changed":
+		return s.Modified
+	case "renamed":
+		return s.Renamed
+	case "copied":
+		return s.Copied
+	default:
+		return DecisionIgnore
+	}
+}
+
+// Policy is the configuration of a repository in PolicyPath.
+type Policy struct {
+	Enabled     bool           `yaml:"enabled"`
+	DryRun      bool           `yaml:"dry_run"`
+	ExemptUsers []string       `yaml:"exempt_users"`
+	ExemptPaths []string       `yaml:"exempt_paths"`
+	Actions     PolicyActions  `yaml:"actions"`
+	Statuses    StatusPolicies `yaml:"statuses"`
+	Trust       TrustPolicy    `yaml:"trust"`
+	// fork runs of first-time contributors.
+	AutoApprove AutoApprovePolicy `yaml:"auto_approve"`
+	// score to cancel on analyze.
+	Threshold int `yaml:"threshold"`
+	// what to do if a pull request has more files than GitHub lists.
+	TooManyFiles string `yaml:"too_many_files"`
+	// what to do if a pull request changes files run by the workflow on the base branch.
+	ExecutedFiles string `yaml:"executed_files"`
+}
+
+// DefaultPolicy is used if the repository has no policy file.
+func DefaultPolicy() *Policy {
+	return &Policy{
+		Enabled: true,
+		DryRun:  false,
+		Actions: PolicyActions{
+			Cancel:  true,
+			Comment: true,
+			Check:   true,
+		},
+		Statuses: StatusPolicies{
+			Added:    DecisionCancel,
+			Modified: DecisionAnalyze,
+			Renamed:  DecisionAnalyze,
+			Copied:   DecisionAnalyze,
+		},
+		Trust:         DefaultTrustPolicy(),
+		Threshold:     DefaultThreshold,
+		TooManyFiles:  DecisionCancel,
+		ExecutedFiles: DecisionCancel,
+	}
+}
+
+// ParsePolicy reads the policy file over the defaults, and validates it.
+func ParsePolicy(b []byte) (*Policy, error) {
+	policy := DefaultPolicy()
+	if err := yaml.UnmarshalStrict(b, policy); err != nil {
+		return nil, fmt.Errorf("%s: %w", PolicyPath, err)
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", PolicyPath, err)
+	}
+	return policy, nil
+}
+
+// Validate returns the error of the first invalid setting.
+func (p *Policy) Validate() error {
+	for _, user := range p.ExemptUsers {
+		if strings.TrimSpace(user) == "" {
+			return fmt.Errorf("exempt_users: empty user name")
+		}
+	}
+	for _, pattern := range p.ExemptPaths {
+		if pattern == "" {
+			return fmt.Errorf("exempt_paths: empty pattern")
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("exempt_paths: %q: %w", pattern, err)
+		}
+	}
+	statuses := []struct {
+		name  string
+		value string
+	}{
+		{"statuses.added", p.Statuses.Added},
+		{"statuses.modified", p.Statuses.Modified},
+		{"statuses.renamed", p.Statuses.Renamed},
+		{"statuses.copied", p.Statuses.Copied},
+	}
+	for _, d := range statuses {
+		if err := validateDecision(d.name, d.value, DecisionCancel, DecisionIgnore, DecisionAnalyze); err != nil {
+			return err
+		}
+	}
+	if err := validateDecision("too_many_files", p.TooManyFiles, DecisionCancel, DecisionIgnore); err != nil {
+		return err
+	}
+	if err := validateDecision("executed_files", p.ExecutedFiles, DecisionCancel, DecisionIgnore); err != nil {
+		return err
+	}
+	if err := p.Trust.Validate(); err != nil {
+		return err
+	}
+	if err := p.AutoApprove.Validate(); err != nil {
+		return err
+	}
+	if p.Threshold < 1 {
+		return fmt.Errorf("threshold: must be positive")
+	}
+	return nil
+}
+
+// IsExemptUser reports whether the user is never cancelled. Logins are case insensitive.
+func (p *Policy) IsExemptUser(login string) bool {
+	for _, user := range p.ExemptUsers {
+		if strings.EqualFold(user, login) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsExemptPath reports whether the workflow file is never cancelled.
+func (p *Policy) IsExemptPath(name string) bool {
+	for _, pattern := range p.ExemptPaths {
+		// patterns are validated on load.
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// FetchPolicy reads the policy on the default branch. Defaults if the file is absent.
+func FetchPolicy(context context.Context, client *Client, owner, repo string) (*Policy, error) {
+	// no ref. default branch is used.
+	file, _, response, err := client.Repositories.GetContents(context, owner, repo, PolicyPath, nil)
+	if err != nil {
+		if response != nil && response.StatusCode == http.StatusNotFound {
+			return DefaultPolicy(), nil
+		}
+		return nil, err
+	}
+	if file == nil {
+		return nil, fmt.Errorf("%s: not a file", PolicyPath)
+	}
+
+	content, err := file.GetContent()
+	if err != nil {
+		return nil, err
+	}
+	return ParsePolicy([]byte(content))
+}
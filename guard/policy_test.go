@@ -0,0 +1,125 @@
+package guard
+
+import (
+	"testing"
+)
+
+func TestParsePolicy(t *testing.T) {
+	cases := []struct {
+		name    string
+		in      string
+		haserr  bool
+		enabled bool
+		dryRun  bool
+		cancel  bool
+		comment bool
+	}{
+		{
+			name:    "empty",
+			in:      "",
+			enabled: true,
+			cancel:  true,
+			comment: true,
+		},
+		{
+			name:    "disabled",
+			in:      "enabled: false",
+			enabled: false,
+			cancel:  true,
+			comment: true,
+		},
+		{
+			name: "dryrun and comment only",
+			in: `
+dry_run: true
+actions:
+  cancel: false
+`,
+			enabled: true,
+			dryRun:  true,
+			cancel:  false,
+			comment: true,
+		},
+		{
+			name:   "unknown key",
+			in:     "enable: false",
+			haserr: true,
+		},
+		{
+			name:   "bad pattern",
+			in:     "exempt_paths: ['[']",
+			haserr: true,
+		},
+		{
+			name:   "unknown too_many_files",
+			in:     "too_many_files: flag",
+			haserr: true,
+		},
+		{
+			name:   "unknown executed_files",
+			in:     "executed_files: analyze",
+			haserr: true,
+		},
+		{
+			name:   "unknown status decision",
+			in:     "statuses: {renamed: warn}",
+			haserr: true,
+		},
+		{
+			name:   "zero threshold",
+			in:     "threshold: 0",
+			haserr: true,
+		},
+		{
+			name:   "bad sensitive path",
+			in:     "auto_approve: {sensitive_paths: ['[']}",
+			haserr: true,
+		},
+		{
+			name:   "empty user",
+			in:     "exempt_users: ['']",
+			haserr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			policy, err := ParsePolicy([]byte(c.in))
+			if (err != nil) != c.haserr {
+				t.Fatal(err)
+			}
+			if err != nil {
+				return
+			}
+			if policy.Enabled != c.enabled || policy.DryRun != c.dryRun {
+				t.Fatalf("%+v", policy)
+			}
+			if policy.Actions.Cancel != c.cancel || policy.Actions.Comment != c.comment {
+				t.Fatalf("%+v", policy.Actions)
+			}
+		})
+	}
+}
+
+func TestRepoPolicyExempt(t *testing.T) {
+	policy, err := ParsePolicy([]byte(`
+exempt_users: [Octocat]
+exempt_paths: [.github/workflows/trusted-*.yml]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !policy.IsExemptUser("octocat") {
+		t.Fatal("octocat")
+	}
+	if policy.IsExemptUser("miner") {
+		t.Fatal("miner")
+	}
+	if !policy.IsExemptPath(".github/workflows/trusted-ci.yml") {
+		t.Fatal("trusted-ci.yml")
+	}
+	if policy.IsExemptPath(".github/workflows/mine.yml") {
+		t.Fatal("mine.yml")
+	}
+}
@@ -0,0 +1,89 @@
+package guard
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-github/v35/github"
+)
+
+// ResolvePullRequests finds open pull requests for the run.
+// workflow_run.pull_requests is always empty if the run comes from a fork,
+// so resolve from the head repository, head branch and head sha.
+func ResolvePullRequests(context context.Context, client *Client, owner, repo string, run *github.WorkflowRun) ([]int, error) {
+	if run.GetEvent() != "pull_request" || run.GetHeadSHA() == "" {
+		return nil, nil
+	}
+
+	var result []int
+
+	headOwner := run.GetHeadRepository().GetOwner().GetLogin()
+	if headOwner != "" && run.GetHeadBranch() != "" {
+		opts := &github.PullRequestListOptions{
+			State:       "open",
+			Head:        fmt.Sprintf("%s:%s", headOwner, run.GetHeadBranch()),
+			ListOptions: github.ListOptions{PerPage: 100},
+		}
+		for {
+			prs, response, err := client.PullRequests.List(context, owner, repo, opts)
+			if err != nil {
+				return nil, err
+			}
+			for _, pr := range prs {
+				if pr.GetHead().GetSHA() == run.GetHeadSHA() {
+					result = append(result, pr.GetNumber())
+				}
+			}
+			if response.NextPage == 0 {
+				break
+			}
+			opts.Page = response.NextPage
+		}
+	}
+	if len(result) > 0 {
+		return result, nil
+	}
+
+	// head branch may be renamed or deleted. fallback to search by sha.
+	query := fmt.Sprintf("repo:%s/%s is:pr is:open %s", owner, repo, run.GetHeadSHA())
+	issues, _, err := client.Search.Issues(context, query, &github.SearchOptions{
+		ListOptions: github.ListOptions{PerPage: 100},
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, issue := range issues.Issues {
+		if issue.IsPullRequest() {
+			result = append(result, issue.GetNumber())
+		}
+	}
+	return result, nil
+}
+
+// GitHub lists at most 3000 files for a pull request.
+const MaxPullRequestFiles = 3000
+
+// ListPullRequestFiles lists all files of the pull request.
+// truncated reports the pull request has more files than GitHub lists.
+func ListPullRequestFiles(context context.Context, client *Client, owner, repo string, pr *github.PullRequest) ([]*github.CommitFile, bool, error) {
+	var result []*github.CommitFile
+
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		files, response, err := client.PullRequests.ListFiles(context, owner, repo, pr.GetNumber(), opts)
+		if err != nil {
+			return nil, false, err
+		}
+		result = append(result, files...)
+		if response.NextPage == 0 {
+			break
+		}
+		if len(result) >= MaxPullRequestFiles {
+			return result, true, nil
+		}
+		opts.Page = response.NextPage
+	}
+
+	truncated := pr.GetChangedFiles() > MaxPullRequestFiles
+	return result, truncated, nil
+}
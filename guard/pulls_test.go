@@ -0,0 +1,168 @@
+package guard
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-github/v35/github"
+)
+
+func TestResolvePullRequests(t *testing.T) {
+	cases := []struct {
+		name   string
+		run    string
+		pulls  string
+		search string
+		want   []int
+	}{
+		{
+			name: "not pull_request",
+			run:  `{"event":"push","head_sha":"abc"}`,
+		},
+		{
+			name:  "found by head",
+			run:   `{"event":"pull_request","head_sha":"abc","head_branch":"feature","head_repository":{"owner":{"login":"fork"}}}`,
+			pulls: `[{"number":1,"head":{"sha":"abc"}},{"number":2,"head":{"sha":"def"}}]`,
+			want:  []int{1},
+		},
+		{
+			name:   "found by search",
+			run:    `{"event":"pull_request","head_sha":"abc","head_branch":"feature","head_repository":{"owner":{"login":"fork"}}}`,
+			pulls:  `[]`,
+			search: `{"total_count":2,"items":[{"number":3,"pull_request":{}},{"number":4}]}`,
+			want:   []int{3},
+		},
+		{
+			name:   "not found",
+			run:    `{"event":"pull_request","head_sha":"abc"}`,
+			search: `{"total_count":0,"items":[]}`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dummy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/api/v3/repos/o/r/pulls":
+					if r.URL.Query().Get("head") != "fork:feature" || r.URL.Query().Get("state") != "open" {
+						t.Errorf("%s", r.URL)
+					}
+					fmt.Fprint(w, c.pulls)
+				case "/api/v3/search/issues":
+					if r.URL.Query().Get("q") != "repo:o/r is:pr is:open abc" {
+						t.Errorf("%s", r.URL)
+					}
+					fmt.Fprint(w, c.search)
+				default:
+					fmt.Printf("%s\n", r.URL)
+					w.WriteHeader(501)
+				}
+			}))
+			defer dummy.Close()
+
+			client, err := github.NewEnterpriseClient(dummy.URL, dummy.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			run := new(github.WorkflowRun)
+			if err := json.Unmarshal([]byte(c.run), run); err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := ResolvePullRequests(context.Background(), NewClient(client), "o", "r", run)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(result, c.want) {
+				t.Fatal(result)
+			}
+		})
+	}
+}
+
+func TestListPullRequestFiles(t *testing.T) {
+	cases := []struct {
+		name          string
+		pages         int
+		changedFiles  int
+		wantFiles     int
+		wantTruncated bool
+	}{
+		{
+			name:         "single page",
+			pages:        1,
+			changedFiles: 100,
+			wantFiles:    100,
+		},
+		{
+			name:         "paginated",
+			pages:        3,
+			changedFiles: 300,
+			wantFiles:    300,
+		},
+		{
+			name:          "over limit",
+			pages:         30,
+			changedFiles:  3001,
+			wantFiles:     3000,
+			wantTruncated: true,
+		},
+		{
+			name:          "more pages than limit",
+			pages:         40,
+			changedFiles:  4000,
+			wantFiles:     3000,
+			wantTruncated: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var dummy *httptest.Server
+			dummy = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/api/v3/repos/o/r/pulls/1/files":
+					page := 1
+					if p := r.URL.Query().Get("page"); p != "" {
+						fmt.Sscanf(p, "%d", &page)
+					}
+					if page < c.pages {
+						w.Header().Set("Link", fmt.Sprintf(`<%s/api/v3/repos/o/r/pulls/1/files?per_page=100&page=%d>; rel="next"`, dummy.URL, page+1))
+					}
+					files := make([]github.CommitFile, 100)
+					json.NewEncoder(w).Encode(files)
+				default:
+					fmt.Printf("%s\n", r.URL)
+					w.WriteHeader(501)
+				}
+			}))
+			defer dummy.Close()
+
+			client, err := github.NewEnterpriseClient(dummy.URL, dummy.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			number := 1
+			pr := &github.PullRequest{
+				Number:       &number,
+				ChangedFiles: &c.changedFiles,
+			}
+
+			files, truncated, err := ListPullRequestFiles(context.Background(), NewClient(client), "o", "r", pr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) != c.wantFiles {
+				t.Fatal(len(files))
+			}
+			if truncated != c.wantTruncated {
+				t.Fatal(truncated)
+			}
+		})
+	}
+}
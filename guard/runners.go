@@ -0,0 +1,105 @@
+package guard
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// installation wide configuration is looked up on the .github repository of the account.
+const (
+	InstallationPolicyRepo = ".github"
+	InstallationPolicyPath = "cancel-workflow-run.yml"
+)
+
+// ReasonSelfHosted is the reason to cancel jobs of untrusted pull requests on protected runners.
+const ReasonSelfHosted = "currently could not accept jobs of untrusted pull request on self-hosted runner"
+
+// RunnerPolicy protects self-hosted runners from untrusted pull requests.
+type RunnerPolicy struct {
+	// labels of runners untrusted jobs never run on.
+	Protected []string `yaml:"protected"`
+	// labels of runners untrusted jobs may run on. e.g. ephemeral sandboxes.
+	Allowed []string `yaml:"allowed"`
+}
+
+// DefaultRunnerPolicy protects all self-hosted runners.
+func DefaultRunnerPolicy() RunnerPolicy {
+	return RunnerPolicy{
+		Protected: []string{"self-hosted"},
+		Allowed:   []string{},
+	}
+}
+
+// Validate returns the error if a label is empty.
+func (r *RunnerPolicy) Validate() error {
+	for _, label := range append(append([]string{}, r.Protected...), r.Allowed...) {
+		if strings.TrimSpace(label) == "" {
+			return fmt.Errorf("runners: empty label")
+		}
+	}
+	return nil
+}
+
+// ProtectedLabel returns the protected label the job runs-on, or empty.
+// Allowed labels take precedence.
+func (r *RunnerPolicy) ProtectedLabel(labels []string) string {
+	for _, label := range labels {
+		if containsFold(r.Allowed, label) {
+			return ""
+		}
+	}
+	for _, label := range labels {
+		if containsFold(r.Protected, label) {
+			return label
+		}
+	}
+	return ""
+}
+
+// InstallationPolicy is the configuration shared by repositories of the installation.
+type InstallationPolicy struct {
+	Runners RunnerPolicy `yaml:"runners"`
+}
+
+// DefaultInstallationPolicy is used if the account has no policy file.
+func DefaultInstallationPolicy() *InstallationPolicy {
+	return &InstallationPolicy{
+		Runners: DefaultRunnerPolicy(),
+	}
+}
+
+// ParseInstallationPolicy reads the policy file over the defaults, and validates it.
+func ParseInstallationPolicy(b []byte) (*InstallationPolicy, error) {
+	policy := DefaultInstallationPolicy()
+	if err := yaml.UnmarshalStrict(b, policy); err != nil {
+		return nil, fmt.Errorf("%s/%s: %w", InstallationPolicyRepo, InstallationPolicyPath, err)
+	}
+	if err := policy.Runners.Validate(); err != nil {
+		return nil, fmt.Errorf("%s/%s: %w", InstallationPolicyRepo, InstallationPolicyPath, err)
+	}
+	return policy, nil
+}
+
+// FetchInstallationPolicy reads the policy of the account. Defaults if the repository or the file is absent.
+func FetchInstallationPolicy(context context.Context, client *Client, owner string) (*InstallationPolicy, error) {
+	file, _, response, err := client.Repositories.GetContents(context, owner, InstallationPolicyRepo, InstallationPolicyPath, nil)
+	if err != nil {
+		if response != nil && response.StatusCode == http.StatusNotFound {
+			return DefaultInstallationPolicy(), nil
+		}
+		return nil, err
+	}
+	if file == nil {
+		return nil, fmt.Errorf("%s/%s: not a file", InstallationPolicyRepo, InstallationPolicyPath)
+	}
+
+	content, err := file.GetContent()
+	if err != nil {
+		return nil, err
+	}
+	return ParseInstallationPolicy([]byte(content))
+}
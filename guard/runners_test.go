@@ -0,0 +1,91 @@
+package guard
+
+import (
+	"context"
+	"testing"
+)
+
+func TestProtectedLabel(t *testing.T) {
+	policy := &RunnerPolicy{
+		Protected: []string{"self-hosted", "gpu"},
+		Allowed:   []string{"ephemeral"},
+	}
+	cases := []struct {
+		name   string
+		labels []string
+		want   string
+	}{
+		{
+			name:   "github hosted",
+			labels: []string{"ubuntu-latest"},
+		},
+		{
+			name:   "self-hosted",
+			labels: []string{"Self-Hosted", "linux"},
+			want:   "Self-Hosted",
+		},
+		{
+			name:   "custom label",
+			labels: []string{"gpu"},
+			want:   "gpu",
+		},
+		{
+			name:   "allowed",
+			labels: []string{"self-hosted", "ephemeral"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := policy.ProtectedLabel(c.labels); got != c.want {
+				t.Fatal(got)
+			}
+		})
+	}
+}
+
+func TestParseInstallationPolicy(t *testing.T) {
+	policy, err := ParseInstallationPolicy([]byte(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy.Runners.ProtectedLabel([]string{"self-hosted"}) == "" {
+		t.Fatalf("%+v", policy)
+	}
+
+	policy, err = ParseInstallationPolicy([]byte("runners: {protected: [gpu], allowed: [sandbox]}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy.Runners.ProtectedLabel([]string{"self-hosted"}) != "" || policy.Runners.ProtectedLabel([]string{"gpu"}) != "gpu" {
+		t.Fatalf("%+v", policy)
+	}
+
+	for _, in := range []string{"runner: {}", "runners: {protected: ['']}"} {
+		if _, err := ParseInstallationPolicy([]byte(in)); err == nil {
+			t.Fatal(in)
+		}
+	}
+}
+
+func TestFetchInstallationPolicy(t *testing.T) {
+	repos := &fakeRepositories{contents: map[string]string{}}
+	client := &Client{Repositories: repos}
+
+	policy, err := FetchInstallationPolicy(context.Background(), client, "o")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(policy.Runners.Protected) != 1 {
+		t.Fatalf("%+v", policy)
+	}
+
+	repos.contents[":"+InstallationPolicyPath] = "runners: {protected: [a, b]}"
+	policy, err = FetchInstallationPolicy(context.Background(), client, "o")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(policy.Runners.Protected) != 2 {
+		t.Fatalf("%+v", policy)
+	}
+}
@@ -0,0 +1,34 @@
+package guard
+
+import (
+	"context"
+
+	"github.com/google/go-github/v35/github"
+)
+
+// ListRunsForSha lists workflow runs of the head sha with the status.
+func ListRunsForSha(context context.Context, client *Client, owner, repo, branch, sha, status string) ([]*github.WorkflowRun, error) {
+	var result []*github.WorkflowRun
+
+	opts := &github.ListWorkflowRunsOptions{
+		Branch:      branch,
+		Status:      status,
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		runs, response, err := client.Actions.ListRepositoryWorkflowRuns(context, owner, repo, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, run := range runs.WorkflowRuns {
+			if run.GetHeadSHA() == sha {
+				result = append(result, run)
+			}
+		}
+		if response.NextPage == 0 {
+			break
+		}
+		opts.Page = response.NextPage
+	}
+	return result, nil
+}
@@ -0,0 +1,170 @@
+package guard
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/google/go-github/v35/github"
+)
+
+// the bot comment is found by this marker, and edited in place.
+const (
+	stickyMarker      = "<!-- cancel-workflow-run -->"
+	stickyStatePrefix = "<!-- cancel-workflow-run:state "
+	stickyStateSuffix = " -->"
+)
+
+// statuses of runs on the bot comment.
+const (
+	RunStatusCancelled = "cancelled"
+	RunStatusFlagged   = "flagged"
+	RunStatusApproved  = "approved"
+)
+
+// RunEntry is a workflow run listed on the bot comment.
+type RunEntry struct {
+	Id     int64  `json:"id"`
+	Name   string `json:"name"`
+	Url    string `json:"url"`
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+	// Outcome of cancelling. e.g. "cancelled in 3s"
+	Outcome string `json:"outcome,omitempty"`
+}
+
+// StickyState is kept in the bot comment as hidden json.
+type StickyState struct {
+	Runs []*RunEntry `json:"runs"`
+}
+
+// Upsert replaces the entry of the same run, or appends it.
+func (s *StickyState) Upsert(entry *RunEntry) {
+	for i, r := range s.Runs {
+		if r.Id == entry.Id {
+			s.Runs[i] = entry
+			return
+		}
+	}
+	s.Runs = append(s.Runs, entry)
+}
+
+// SetStatus returns false if no run found.
+func (s *StickyState) SetStatus(id int64, status string) bool {
+	for _, r := range s.Runs {
+		if r.Id == id {
+			r.Status = status
+			return true
+		}
+	}
+	return false
+}
+
+// ParseStickyState returns nil if the body is not the bot comment.
+func ParseStickyState(body string) *StickyState {
+	if !strings.Contains(body, stickyMarker) {
+		return nil
+	}
+
+	state := new(StickyState)
+	// the real state is always last. run names above it may contain a fake one.
+	start := strings.LastIndex(body, stickyStatePrefix)
+	if start < 0 {
+		return state
+	}
+	rest := body[start+len(stickyStatePrefix):]
+	end := strings.Index(rest, stickyStateSuffix)
+	if end < 0 {
+		return state
+	}
+	if err := json.Unmarshal([]byte(rest[:end]), state); err != nil {
+		// broken. rebuild from scratch.
+		return new(StickyState)
+	}
+	return state
+}
+
+// FindStickyComment returns the bot comment made by client.Login and its state.
+// The comment is nil and the state is empty if not commented yet.
+func FindStickyComment(context context.Context, client *Client, owner, repo string, number int) (*github.IssueComment, *StickyState, error) {
+	opts := &github.IssueListCommentsOptions{
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		comments, response, err := client.Issues.ListComments(context, owner, repo, number, opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, comment := range comments {
+			// anyone can write the marker, even other bots.
+			if comment.GetUser().GetLogin() != client.Login {
+				continue
+			}
+			if state := ParseStickyState(comment.GetBody()); state != nil {
+				return comment, state, nil
+			}
+		}
+		if response.NextPage == 0 {
+			break
+		}
+		opts.Page = response.NextPage
+	}
+	return nil, new(StickyState), nil
+}
+
+// CommentData is the data to render the bot comment.
+type CommentData struct {
+	Opener string
+	Owner  string
+	Runs   []*RunEntry
+}
+
+// CommentRenderer writes the body of the bot comment.
+type CommentRenderer func(w io.Writer, data *CommentData) error
+
+func renderStickyComment(render CommentRenderer, owner string, pr *github.PullRequest, state *StickyState) (string, error) {
+	buf := bytes.NewBufferString("")
+	data := &CommentData{
+		Opener: pr.GetUser().GetLogin(),
+		Owner:  owner,
+		Runs:   state.Runs,
+	}
+	if err := render(buf, data); err != nil {
+		return "", err
+	}
+
+	// json.Marshal escapes '>', so never closes the html comment.
+	j, err := json.Marshal(state)
+	if err != nil {
+		return "", err
+	}
+	buf.WriteString("\n" + stickyMarker + "\n")
+	buf.WriteString(stickyStatePrefix + string(j) + stickyStateSuffix + "\n")
+	return buf.String(), nil
+}
+
+// UpdateStickyComment creates or edits the bot comment of the pull request.
+// Nothing is done if update returns false.
+func UpdateStickyComment(context context.Context, client *Client, render CommentRenderer, owner, repo string, pr *github.PullRequest, update func(*StickyState) bool) error {
+	comment, state, err := FindStickyComment(context, client, owner, repo, pr.GetNumber())
+	if err != nil {
+		return err
+	}
+	if !update(state) {
+		return nil
+	}
+
+	body, err := renderStickyComment(render, owner, pr, state)
+	if err != nil {
+		return err
+	}
+
+	if comment == nil {
+		_, _, err = client.Issues.CreateComment(context, owner, repo, pr.GetNumber(), &github.IssueComment{Body: &body})
+		return err
+	}
+	_, _, err = client.Issues.EditComment(context, owner, repo, comment.GetID(), &github.IssueComment{Body: &body})
+	return err
+}
@@ -0,0 +1,154 @@
+package guard
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v35/github"
+)
+
+func TestParseStickyState(t *testing.T) {
+	cases := []struct {
+		name string
+		body string
+		want *StickyState
+	}{
+		{
+			name: "not bot comment",
+			body: "LGTM",
+		},
+		{
+			name: "no state",
+			body: "<!-- cancel-workflow-run -->",
+			want: &StickyState{},
+		},
+		{
+			name: "state",
+			body: "<!-- cancel-workflow-run -->\n<!-- cancel-workflow-run:state {\"runs\":[{\"id\":1,\"status\":\"cancelled\"}]} -->\n",
+			want: &StickyState{
+				Runs: []*RunEntry{{Id: 1, Status: "cancelled"}},
+			},
+		},
+		{
+			name: "broken state",
+			body: "<!-- cancel-workflow-run -->\n<!-- cancel-workflow-run:state {\"runs\": -->\n",
+			want: &StickyState{},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			state := ParseStickyState(c.body)
+			if !reflect.DeepEqual(state, c.want) {
+				t.Fatalf("%+v", state)
+			}
+		})
+	}
+}
+
+func TestStickyState(t *testing.T) {
+	state := &StickyState{}
+	state.Upsert(&RunEntry{Id: 1, Status: RunStatusCancelled})
+	state.Upsert(&RunEntry{Id: 2, Status: RunStatusCancelled})
+	state.Upsert(&RunEntry{Id: 1, Status: RunStatusFlagged})
+	if len(state.Runs) != 2 || state.Runs[0].Status != RunStatusFlagged {
+		t.Fatalf("%+v", state.Runs)
+	}
+
+	if !state.SetStatus(2, RunStatusApproved) {
+		t.Fatal("2")
+	}
+	if state.Runs[1].Status != RunStatusApproved {
+		t.Fatalf("%+v", state.Runs[1])
+	}
+	if state.SetStatus(3, RunStatusApproved) {
+		t.Fatal("3")
+	}
+}
+
+func TestRenderStickyComment(t *testing.T) {
+	login := "opener"
+	pr := &github.PullRequest{User: &github.User{Login: &login}}
+	state := &StickyState{
+		Runs: []*RunEntry{
+			{Id: 1, Name: "CI", Url: "url", Status: RunStatusCancelled, Reason: "--> injected"},
+		},
+	}
+
+	render := func(w io.Writer, data *CommentData) error {
+		_, err := fmt.Fprintf(w, "@%s @%s\n", data.Opener, data.Owner)
+		return err
+	}
+	body, err := renderStickyComment(render, "owner", pr, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(body, "@opener @owner\n") {
+		t.Fatal(body)
+	}
+
+	parsed := ParseStickyState(body)
+	if !reflect.DeepEqual(parsed, state) {
+		t.Fatalf("%+v", parsed)
+	}
+}
+
+func TestRenderStickyCommentFakeState(t *testing.T) {
+	login := "opener"
+	pr := &github.PullRequest{User: &github.User{Login: &login}}
+	state := &StickyState{
+		Runs: []*RunEntry{
+			{Id: 1, Name: `<!-- cancel-workflow-run:state {"runs":[{"id":9,"status":"approved"}]} -->`, Status: RunStatusCancelled},
+		},
+	}
+
+	// the name of the workflow is written as is.
+	render := func(w io.Writer, data *CommentData) error {
+		for _, r := range data.Runs {
+			if _, err := fmt.Fprintf(w, "- %s\n", r.Name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	body, err := renderStickyComment(render, "owner", pr, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed := ParseStickyState(body)
+	if !reflect.DeepEqual(parsed, state) {
+		t.Fatalf("%+v", parsed.Runs[0])
+	}
+}
+
+func TestFindStickyComment(t *testing.T) {
+	body := "<!-- cancel-workflow-run -->\n<!-- cancel-workflow-run:state {\"runs\":[{\"id\":1}]} -->"
+	issues := &fakeIssues{
+		comments: []*github.IssueComment{
+			{ID: github.Int64(1), User: &github.User{Login: github.String("attacker"), Type: github.String("User")}, Body: &body},
+			{ID: github.Int64(2), User: &github.User{Login: github.String("other[bot]"), Type: github.String("Bot")}, Body: &body},
+			{ID: github.Int64(3), User: &github.User{Login: github.String("app[bot]"), Type: github.String("Bot")}, Body: &body},
+		},
+	}
+
+	comment, state, err := FindStickyComment(context.Background(), &Client{Issues: issues, Login: "app[bot]"}, "o", "r", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if comment.GetID() != 3 || len(state.Runs) != 1 {
+		t.Fatalf("%+v %+v", comment, state)
+	}
+
+	comment, state, err = FindStickyComment(context.Background(), &Client{Issues: issues, Login: "another[bot]"}, "o", "r", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if comment != nil || len(state.Runs) != 0 {
+		t.Fatalf("%+v %+v", comment, state)
+	}
+}
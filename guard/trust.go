@@ -0,0 +1,118 @@
+package guard
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/v35/github"
+)
+
+// https://docs.github.com/en/graphql/reference/enums#commentauthorassociation
+var authorAssociations = []string{
+	"COLLABORATOR",
+	"CONTRIBUTOR",
+	"FIRST_TIMER",
+	"FIRST_TIME_CONTRIBUTOR",
+	"MANNEQUIN",
+	"MEMBER",
+	"NONE",
+	"OWNER",
+}
+
+// permissions returned by the collaborator permission level API.
+var permissionLevels = []string{"admin", "write", "read", "none"}
+
+// TrustPolicy is who is trusted to change workflows.
+type TrustPolicy struct {
+	// author associations never cancelled.
+	Associations []string `yaml:"associations"`
+	// collaborator permissions never cancelled.
+	Permissions []string `yaml:"permissions"`
+	// bot accounts never cancelled.
+	Bots []string `yaml:"bots"`
+}
+
+// DefaultTrustPolicy trusts owners, members, collaborators with write permission and well-known bots.
+func DefaultTrustPolicy() TrustPolicy {
+	return TrustPolicy{
+		Associations: []string{"OWNER", "MEMBER"},
+		Permissions:  []string{"admin", "write"},
+		Bots:         []string{"dependabot[bot]", "renovate[bot]"},
+	}
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate returns the error of an unknown association or permission.
+func (t *TrustPolicy) Validate() error {
+	for _, a := range t.Associations {
+		if !containsFold(authorAssociations, a) {
+			return fmt.Errorf("trust.associations: unknown association %q", a)
+		}
+	}
+	for _, p := range t.Permissions {
+		if !containsFold(permissionLevels, p) {
+			return fmt.Errorf("trust.permissions: unknown permission %q", p)
+		}
+	}
+	return nil
+}
+
+// TrustedUser reports whether user is trusted. The reason is returned if trusted.
+func (t *TrustPolicy) TrustedUser(context context.Context, client *Client, owner, repo, login, association string) (bool, string, error) {
+	if containsFold(t.Bots, login) {
+		return true, "trusted bot", nil
+	}
+	if association != "" && containsFold(t.Associations, association) {
+		return true, fmt.Sprintf("author association %s", association), nil
+	}
+	if len(t.Permissions) == 0 || login == "" {
+		return false, "", nil
+	}
+
+	level, response, err := client.Repositories.GetPermissionLevel(context, owner, repo, login)
+	if err != nil {
+		if response != nil && response.StatusCode == http.StatusNotFound {
+			return false, "", nil
+		}
+		return false, "", err
+	}
+	if containsFold(t.Permissions, level.GetPermission()) {
+		return true, fmt.Sprintf("%s permission", level.GetPermission()), nil
+	}
+	return false, "", nil
+}
+
+// TrustedAuthor reports whether the pull request author is trusted.
+func (t *TrustPolicy) TrustedAuthor(context context.Context, client *Client, owner, repo string, pr *github.PullRequest) (bool, string, error) {
+	return t.TrustedUser(context, client, owner, repo, pr.GetUser().GetLogin(), pr.GetAuthorAssociation())
+}
+
+// HasWritePermission reports whether user can approve workflow runs.
+func HasWritePermission(context context.Context, client *Client, owner, repo, login string) (bool, error) {
+	if login == "" {
+		return false, nil
+	}
+	level, response, err := client.Repositories.GetPermissionLevel(context, owner, repo, login)
+	if err != nil {
+		if response != nil && response.StatusCode == http.StatusNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	switch level.GetPermission() {
+	case "admin", "write":
+		return true, nil
+	default:
+		return false, nil
+	}
+}
@@ -0,0 +1,104 @@
+package guard
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-github/v35/github"
+)
+
+func TestTrustedUser(t *testing.T) {
+	cases := []struct {
+		name        string
+		login       string
+		association string
+		status      int
+		permission  string
+		want        bool
+		haserr      bool
+	}{
+		{
+			name:  "bot",
+			login: "dependabot[bot]",
+			want:  true,
+		},
+		{
+			name:        "owner",
+			login:       "octocat",
+			association: "OWNER",
+			want:        true,
+		},
+		{
+			name:        "write",
+			login:       "octocat",
+			association: "COLLABORATOR",
+			status:      200,
+			permission:  "write",
+			want:        true,
+		},
+		{
+			name:        "read",
+			login:       "octocat",
+			association: "CONTRIBUTOR",
+			status:      200,
+			permission:  "read",
+		},
+		{
+			name:        "not collaborator",
+			login:       "octocat",
+			association: "FIRST_TIME_CONTRIBUTOR",
+			status:      404,
+		},
+		{
+			name:   "error",
+			login:  "octocat",
+			status: 500,
+			haserr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dummy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/api/v3/repos/o/r/collaborators/octocat/permission":
+					w.WriteHeader(c.status)
+					fmt.Fprintf(w, `{"permission":%q}`, c.permission)
+				default:
+					fmt.Printf("%s\n", r.URL)
+					w.WriteHeader(501)
+				}
+			}))
+			defer dummy.Close()
+
+			client, err := github.NewEnterpriseClient(dummy.URL, dummy.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			trust := DefaultTrustPolicy()
+			trusted, _, err := trust.TrustedUser(context.Background(), NewClient(client), "o", "r", c.login, c.association)
+			if (err != nil) != c.haserr {
+				t.Fatal(err)
+			}
+			if trusted != c.want {
+				t.Fatal(trusted)
+			}
+		})
+	}
+}
+
+func TestTrustPolicyValidate(t *testing.T) {
+	if _, err := ParsePolicy([]byte("trust: {associations: [owner, COLLABORATOR]}")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParsePolicy([]byte("trust: {associations: [ADMIN]}")); err == nil {
+		t.Fatal("ADMIN")
+	}
+	if _, err := ParsePolicy([]byte("trust: {permissions: [maintain]}")); err == nil {
+		t.Fatal("maintain")
+	}
+}
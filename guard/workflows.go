@@ -0,0 +1,115 @@
+package guard
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/v35/github"
+)
+
+const workflowsDir = ".github/workflows/"
+
+// IsWorkflowPath reports whether the file is under .github/workflows.
+func IsWorkflowPath(name string) bool {
+	return strings.HasPrefix(name, workflowsDir)
+}
+
+// WorkflowChange is a change of the workflow file made by a pull request.
+type WorkflowChange struct {
+	Status           string
+	Filename         string
+	PreviousFilename string
+	// Base is nil if the file was not a workflow on base branch.
+	Base []byte
+	// Head is nil if the content is not found at the run.
+	Head []byte
+}
+
+// Reason is the reason to cancel the run by the status of the change.
+func (w *WorkflowChange) Reason() string {
+	switch w.Status {
+	case "added":
+		return ReasonAddedWorkflow
+	case "renamed":
+		return "currently could not accept workflow renamed at pull request"
+	case "copied":
+		return "currently could not accept workflow copied at pull request"
+	default:
+		return "currently could not accept workflow modified at pull request"
+	}
+}
+
+// fetchContent returns nil if not found.
+func fetchContent(context context.Context, client *Client, owner, repo, path, ref string) ([]byte, error) {
+	opts := &github.RepositoryContentGetOptions{Ref: ref}
+	file, _, response, err := client.Repositories.GetContents(context, owner, repo, path, opts)
+	if err != nil {
+		if response != nil && response.StatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if file == nil {
+		return nil, nil
+	}
+
+	content, err := file.GetContent()
+	if err != nil {
+		return nil, err
+	}
+	return []byte(content), nil
+}
+
+// FindWorkflowChange finds the change of the workflow in pull request files.
+// The content is read at headSha, the commit the run executes.
+// Returns nil if the pull request does not change the workflow
+// or the content is same as base branch.
+func FindWorkflowChange(context context.Context, client *Client, owner, repo string, pr *github.PullRequest, files []*github.CommitFile, workflowPath, headSha string) (*WorkflowChange, error) {
+	var file *github.CommitFile
+	for _, f := range files {
+		if f.GetFilename() == workflowPath {
+			file = f
+			break
+		}
+	}
+	if file == nil || file.GetStatus() == "removed" {
+		return nil, nil
+	}
+
+	change := &WorkflowChange{
+		Status:           file.GetStatus(),
+		Filename:         file.GetFilename(),
+		PreviousFilename: file.GetPreviousFilename(),
+	}
+
+	if headSha == "" {
+		headSha = pr.GetHead().GetSHA()
+	}
+	head, err := fetchContent(context, client, owner, repo, change.Filename, headSha)
+	if err != nil {
+		return nil, err
+	}
+	change.Head = head
+
+	basePath := change.Filename
+	if change.PreviousFilename != "" {
+		basePath = change.PreviousFilename
+	}
+	if change.Status == "added" || !IsWorkflowPath(basePath) {
+		// new workflow. nothing to compare.
+		return change, nil
+	}
+
+	base, err := fetchContent(context, client, owner, repo, basePath, pr.GetBase().GetRef())
+	if err != nil {
+		return nil, err
+	}
+	change.Base = base
+
+	if base != nil && head != nil && bytes.Equal(base, head) {
+		return nil, nil
+	}
+	return change, nil
+}
@@ -0,0 +1,164 @@
+package guard
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v35/github"
+)
+
+func TestFindWorkflowChange(t *testing.T) {
+	cases := []struct {
+		name     string
+		files    string
+		contents map[string]string
+		// sha of the run. default: head
+		sha        string
+		wantStatus string
+		wantBase   bool
+		wantNoHead bool
+	}{
+		{
+			name:  "not changed",
+			files: `[{"filename":"README.md","status":"modified"}]`,
+		},
+		{
+			name:  "removed",
+			files: `[{"filename":".github/workflows/ci.yml","status":"removed"}]`,
+		},
+		{
+			name:  "added",
+			files: `[{"filename":".github/workflows/ci.yml","status":"added"}]`,
+			contents: map[string]string{
+				"head:.github/workflows/ci.yml": "on: push",
+			},
+			wantStatus: "added",
+		},
+		{
+			name:  "modified",
+			files: `[{"filename":".github/workflows/ci.yml","status":"modified"}]`,
+			contents: map[string]string{
+				"main:.github/workflows/ci.yml": "on: push",
+				"head:.github/workflows/ci.yml": "on: pull_request",
+			},
+			wantStatus: "modified",
+			wantBase:   true,
+		},
+		{
+			name:  "modified same content",
+			files: `[{"filename":".github/workflows/ci.yml","status":"modified"}]`,
+			contents: map[string]string{
+				"main:.github/workflows/ci.yml": "on: push",
+				"head:.github/workflows/ci.yml": "on: push",
+			},
+		},
+		{
+			name:  "renamed into workflows",
+			files: `[{"filename":".github/workflows/ci.yml","previous_filename":"ci.yml","status":"renamed"}]`,
+			contents: map[string]string{
+				"main:ci.yml":                   "on: push",
+				"head:.github/workflows/ci.yml": "on: push",
+			},
+			wantStatus: "renamed",
+		},
+		{
+			name:  "renamed in workflows",
+			files: `[{"filename":".github/workflows/ci.yml","previous_filename":".github/workflows/old.yml","status":"renamed"}]`,
+			contents: map[string]string{
+				"main:.github/workflows/old.yml": "on: push",
+				"head:.github/workflows/ci.yml":  "on: push",
+			},
+		},
+		{
+			name:  "copied and changed",
+			files: `[{"filename":".github/workflows/ci.yml","previous_filename":".github/workflows/old.yml","status":"copied"}]`,
+			contents: map[string]string{
+				"main:.github/workflows/old.yml": "on: push",
+				"head:.github/workflows/ci.yml":  "on: pull_request",
+			},
+			wantStatus: "copied",
+			wantBase:   true,
+		},
+		{
+			name:  "reverted after the run",
+			files: `[{"filename":".github/workflows/ci.yml","status":"modified"}]`,
+			sha:   "run",
+			contents: map[string]string{
+				"main:.github/workflows/ci.yml": "on: push",
+				"run:.github/workflows/ci.yml":  "on: pull_request",
+				"head:.github/workflows/ci.yml": "on: push",
+			},
+			wantStatus: "modified",
+			wantBase:   true,
+		},
+		{
+			name:  "not found at the run",
+			files: `[{"filename":".github/workflows/ci.yml","status":"modified"}]`,
+			contents: map[string]string{
+				"main:.github/workflows/ci.yml": "on: push",
+			},
+			wantStatus: "modified",
+			wantBase:   true,
+			wantNoHead: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dummy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				prefix := "/api/v3/repos/o/r/contents/"
+				if !strings.HasPrefix(r.URL.Path, prefix) {
+					fmt.Printf("%s\n", r.URL)
+					w.WriteHeader(501)
+					return
+				}
+				content, exists := c.contents[r.URL.Query().Get("ref")+":"+strings.TrimPrefix(r.URL.Path, prefix)]
+				if !exists {
+					w.WriteHeader(404)
+					return
+				}
+				fmt.Fprintf(w, `{"type":"file","encoding":"base64","content":%q}`, base64.StdEncoding.EncodeToString([]byte(content)))
+			}))
+			defer dummy.Close()
+
+			client, err := github.NewEnterpriseClient(dummy.URL, dummy.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pr := new(github.PullRequest)
+			if err := json.Unmarshal([]byte(`{"head":{"sha":"head"},"base":{"ref":"main"}}`), pr); err != nil {
+				t.Fatal(err)
+			}
+			var files []*github.CommitFile
+			if err := json.Unmarshal([]byte(c.files), &files); err != nil {
+				t.Fatal(err)
+			}
+
+			change, err := FindWorkflowChange(context.Background(), NewClient(client), "o", "r", pr, files, ".github/workflows/ci.yml", c.sha)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.wantStatus == "" {
+				if change != nil {
+					t.Fatalf("%+v", change)
+				}
+				return
+			}
+			if change == nil || change.Status != c.wantStatus {
+				t.Fatalf("%+v", change)
+			}
+			if (change.Base != nil) != c.wantBase {
+				t.Fatalf("%s", change.Base)
+			}
+			if (change.Head == nil) != c.wantNoHead {
+				t.Fatalf("%s", change.Head)
+			}
+		})
+	}
+}
@@ -1,6 +1,13 @@
 package main
 
 import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"strings"
+
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/gommon/log"
 
@@ -20,11 +27,263 @@ func intoJson(b []byte) json.RawMessage {
 	return j
 }
 
-func handleBodyDump(c echo.Context, req, res []byte) {
-	body := log.JSON{
-		"req": intoJson(req),
-		"res": intoJson(res),
+const redactedValue = "[REDACTED]"
+
+// defaultRedactPaths are values never logged.
+var defaultRedactPaths = []string{
+	// setup redirects to a SAS signed url of the blob holding the app secrets.
+	"$..Location",
+	"$..Authorization",
+	"$..Cookie",
+	"$..X-Hub-Signature",
+	"$..X-Hub-Signature-256",
+	// code of the app manifest conversion.
+	"$..Query.code",
+	"$..token",
+	"$..pem",
+	"$..webhook_secret",
+	"$..client_secret",
+}
+
+// defaultRedactPatterns are replaced in any string.
+var defaultRedactPatterns = []string{
+	`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`,
+	// SAS signature. the rest of the escaped url is dropped too.
+	`(?i)\bsig(=|%3D)[^&\s"]+`,
+	`(?i)\bAccountKey=[^;\s"]+`,
+	`\bgh[pousr]_[A-Za-z0-9]{36,255}\b`,
+	`\bgithub_pat_[A-Za-z0-9_]{22,255}\b`,
+	`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`,
+}
+
+// logRedaction configures the body dump.
+type logRedaction struct {
+	// Paths are like `$.a.b`. `*` matches any key or index, and `..` any depth. Keys are case insensitive.
+	Paths []string
+	// Patterns are regular expressions replaced in strings.
+	Patterns []string
+	// MaxSize truncates the body in bytes. 0 is unlimited.
+	MaxSize int
+	// SampleRate is the ratio of successful requests dumped. Errors are always dumped.
+	SampleRate float64
+}
+
+func defaultLogRedaction() *logRedaction {
+	return &logRedaction{
+		Paths:      append([]string{}, defaultRedactPaths...),
+		Patterns:   append([]string{}, defaultRedactPatterns...),
+		MaxSize:    8192,
+		SampleRate: 1,
+	}
+}
+
+type redactor struct {
+	paths      [][]string
+	patterns   []*regexp.Regexp
+	maxSize    int
+	sampleRate float64
+	random     func() float64
+}
+
+// parseRedactPath splits `$.a..b.*` into [a .. b *].
+func parseRedactPath(p string) ([]string, error) {
+	if !strings.HasPrefix(p, "$") {
+		return nil, fmt.Errorf("%s: path must start with $", p)
+	}
+	var result []string
+	rest := p[1:]
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			result = append(result, "..")
+			rest = rest[2:]
+		case strings.HasPrefix(rest, "."):
+			rest = rest[1:]
+		default:
+			return nil, fmt.Errorf("%s: unexpected %q", p, rest)
+		}
+		name := rest
+		if i := strings.Index(rest, "."); i >= 0 {
+			name = rest[:i]
+		}
+		if name == "" {
+			return nil, fmt.Errorf("%s: empty key", p)
+		}
+		result = append(result, name)
+		rest = rest[len(name):]
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("%s: empty path", p)
+	}
+	return result, nil
+}
+
+func newRedactor(conf *logRedaction) (*redactor, error) {
+	if conf.MaxSize < 0 {
+		return nil, fmt.Errorf("negative max size %d", conf.MaxSize)
+	}
+	if conf.SampleRate < 0 || conf.SampleRate > 1 {
+		return nil, fmt.Errorf("sample rate %v is not in [0, 1]", conf.SampleRate)
+	}
+
+	r := &redactor{
+		maxSize:    conf.MaxSize,
+		sampleRate: conf.SampleRate,
+		random:     rand.Float64,
+	}
+	for _, p := range conf.Paths {
+		path, err := parseRedactPath(p)
+		if err != nil {
+			return nil, err
+		}
+		r.paths = append(r.paths, path)
+	}
+	for _, p := range conf.Patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, err
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	return r, nil
+}
+
+func decodeJson(b []byte) (interface{}, error) {
+	var v interface{}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// expand decodes strings holding json. e.g. the http binding body of Azure Functions.
+func expand(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			v[k] = expand(child)
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = expand(child)
+		}
+	case string:
+		s := strings.TrimSpace(v)
+		if strings.HasPrefix(s, "{") || strings.HasPrefix(s, "[") {
+			if j, err := decodeJson([]byte(s)); err == nil {
+				return expand(j)
+			}
+		}
+	}
+	return v
+}
+
+func redactPath(v interface{}, path []string) interface{} {
+	if len(path) == 0 {
+		return redactedValue
+	}
+
+	if path[0] == ".." {
+		v = redactPath(v, path[1:])
+		switch c := v.(type) {
+		case map[string]interface{}:
+			for k, child := range c {
+				c[k] = redactPath(child, path)
+			}
+		case []interface{}:
+			for i, child := range c {
+				c[i] = redactPath(child, path)
+			}
+		}
+		return v
+	}
+
+	switch c := v.(type) {
+	case map[string]interface{}:
+		for k, child := range c {
+			if path[0] == "*" || strings.EqualFold(k, path[0]) {
+				c[k] = redactPath(child, path[1:])
+			}
+		}
+	case []interface{}:
+		for i, child := range c {
+			if path[0] == "*" || path[0] == fmt.Sprint(i) {
+				c[i] = redactPath(child, path[1:])
+			}
+		}
+	}
+	return v
+}
+
+func (r *redactor) scrub(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, child := range v {
+			v[k] = r.scrub(child)
+		}
+	case []interface{}:
+		for i, child := range v {
+			v[i] = r.scrub(child)
+		}
+	case string:
+		for _, re := range r.patterns {
+			v = re.ReplaceAllString(v, redactedValue)
+		}
+		return v
+	}
+	return v
+}
+
+// marshal does not escape html. urls in logs stay readable.
+func marshal(v interface{}) json.RawMessage {
+	b := new(bytes.Buffer)
+	encoder := json.NewEncoder(b)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(v); err != nil {
+		panic(err)
+	}
+	return bytes.TrimRight(b.Bytes(), "\n")
+}
+
+// redact returns the body safe to log.
+func (r *redactor) redact(b []byte) json.RawMessage {
+	v, err := decodeJson(intoJson(b))
+	if err != nil {
+		panic(err)
+	}
+	v = expand(v)
+	for _, path := range r.paths {
+		v = redactPath(v, path)
+	}
+	v = r.scrub(v)
+
+	j := marshal(v)
+	if r.maxSize > 0 && len(j) > r.maxSize {
+		j = marshal(fmt.Sprintf("%s...(%d bytes truncated)", j[:r.maxSize], len(j)-r.maxSize))
+	}
+	return j
+}
+
+func (r *redactor) sampled(status int) bool {
+	if status >= http.StatusBadRequest || r.sampleRate >= 1 {
+		return true
 	}
+	return r.random() < r.sampleRate
+}
 
-	c.Echo().Logger.Infoj(body)
+func bodyDump(r *redactor) func(echo.Context, []byte, []byte) {
+	return func(c echo.Context, req, res []byte) {
+		if !r.sampled(c.Response().Status) {
+			return
+		}
+
+		body := log.JSON{
+			"req": r.redact(req),
+			"res": r.redact(res),
+		}
+
+		c.Echo().Logger.Infoj(body)
+	}
 }
@@ -5,15 +5,23 @@ import (
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/labstack/gommon/log"
+	"github.com/yskszk63/cancel-workflow-run/guard"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
 	"bytes"
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 type queueMessage struct {
@@ -22,6 +30,19 @@ type queueMessage struct {
 	RepositoryName  string `json:"RepositoryName"`
 	WorkflowRunId   int64  `json:"WorkflowRunId"`
 	PullRequestNums []int  `json:"PullRequestNums"`
+	RunAttempt      int    `json:"RunAttempt"`
+	TriggeringActor string `json:"TriggeringActor"`
+	DeliveryId      string `json:"DeliveryId"`
+	// TraceContext resumes the trace of the webhook.
+	TraceContext traceCarrier `json:"TraceContext,omitempty"`
+}
+
+// workflow_run fields not supported by go-github v35.
+type workflowRunPayload struct {
+	WorkflowRun struct {
+		RunAttempt      int          `json:"run_attempt"`
+		TriggeringActor *github.User `json:"triggering_actor"`
+	} `json:"workflow_run"`
 }
 
 func hello(c echo.Context) error {
@@ -34,7 +55,10 @@ func setupGitHubApp(c echo.Context) error {
 	}
 
 	env := getEnv(c)
-	connStr := env.storageConnectionString()
+	if err := env.config().require(storageSettings...); err != nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, err.Error()).SetInternal(err)
+	}
+	connStr := env.config().StorageConnectionString
 
 	container, blob := "setup", "azuredeploy.json"
 
@@ -88,7 +112,10 @@ func postSetupGitHubApp(c echo.Context) error {
 	}
 
 	env := getEnv(c)
-	connStr := env.storageConnectionString()
+	if err := env.config().require(storageSettings...); err != nil {
+		return echo.NewHTTPError(http.StatusServiceUnavailable, err.Error()).SetInternal(err)
+	}
+	connStr := env.config().StorageConnectionString
 
 	cred, err := newAzblobCredential(connStr)
 	if err != nil {
@@ -136,12 +163,24 @@ func postSetupGitHubApp(c echo.Context) error {
 	return c.Redirect(http.StatusFound, deployurl)
 }
 
-func webhook(c echo.Context) error {
+func webhook(c echo.Context) (err error) {
 	payload, err := io.ReadAll(c.Request().Body)
 	if err != nil {
 		return err
 	}
-	event, err := github.ParseWebHook(github.WebHookType(c.Request()), payload)
+	deliveryId := github.DeliveryID(c.Request())
+	eventType, action := github.WebHookType(c.Request()), webhookAction(payload)
+	webhooksReceived.inc(eventType, action)
+
+	ctx, span := tracer().Start(c.Request().Context(), "webhook "+eventType,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(webhookSpanAttributes(eventType, action, deliveryId)...))
+	defer func() { endSpan(span, err) }()
+	c.SetRequest(c.Request().WithContext(ctx))
+	if eventType == "workflow_job" {
+		return workflowJobWebhook(c, payload, deliveryId)
+	}
+	event, err := github.ParseWebHook(eventType, payload)
 	if err != nil {
 		return err
 	}
@@ -154,7 +193,8 @@ func webhook(c echo.Context) error {
 		return c.NoContent(http.StatusNoContent)
 
 	case *github.WorkflowRunEvent:
-		if event.GetAction() == "completed" {
+		// fork runs held for the approval are completed as action_required.
+		if event.GetAction() == "completed" && !guard.IsActionRequired(event.GetWorkflowRun()) {
 			return c.NoContent(http.StatusNoContent)
 		}
 
@@ -163,6 +203,15 @@ func webhook(c echo.Context) error {
 			return err
 		}
 
+		runPayload := new(workflowRunPayload)
+		if err := json.Unmarshal(payload, runPayload); err != nil {
+			return err
+		}
+		actor := runPayload.WorkflowRun.TriggeringActor.GetLogin()
+		if actor == "" {
+			actor = event.GetSender().GetLogin()
+		}
+
 		var pullRequestNums []int
 		for _, pr := range event.GetWorkflowRun().PullRequests {
 			pullRequestNums = append(pullRequestNums, pr.GetNumber())
@@ -173,100 +222,145 @@ func webhook(c echo.Context) error {
 			RepositoryName:  event.GetRepo().GetName(),
 			WorkflowRunId:   event.GetWorkflowRun().GetID(),
 			PullRequestNums: pullRequestNums,
+			RunAttempt:      runPayload.WorkflowRun.RunAttempt,
+			TriggeringActor: actor,
+			DeliveryId:      deliveryId,
+			TraceContext:    injectTraceContext(c.Request().Context()),
 		}
-		evt, err := newEventGridEvent(fmt.Sprintf("%d", whPayload.GetInstallation().GetID()), "CancelWorkflowRunJob", "0", msg)
+		evt, err := newEventGridEvent(fmt.Sprintf("%d", whPayload.GetInstallation().GetID()), eventTypeCancelWorkflowRun, "0", msg)
 		if err != nil {
 			return err
 		}
-		setOutput(c, "msg", evt)
+		evt.setDeliveryId(deliveryId)
+		if err := enqueueJob(c, evt); err != nil {
+			return err
+		}
 		return c.NoContent(http.StatusAccepted)
 
+	case *github.IssueCommentEvent:
+		return enqueueCommand(c, newCommandMessage(event), deliveryId)
+
+	case *github.CheckRunEvent:
+		return enqueueCommand(c, newCheckRunCommandMessage(event), deliveryId)
+
 	default:
 		return echo.NewHTTPError(http.StatusBadRequest, fmt.Errorf("Unsupported Event Type %s", event))
 	}
 }
 
-func process(c echo.Context) error {
-	env := getEnv(c)
-
-	request := new(invokeRequest)
-	if err := c.Bind(request); err != nil {
+// enqueueCommand passes the command to process. nil is not a command.
+func enqueueCommand(c echo.Context, msg *commandMessage, deliveryId string) error {
+	if msg == nil {
+		return c.NoContent(http.StatusNoContent)
+	}
+	msg.DeliveryId = deliveryId
+	msg.TraceContext = injectTraceContext(c.Request().Context())
+	evt, err := newEventGridEvent(fmt.Sprintf("%d", msg.InstallationId), eventTypeWorkflowCommand, "0", msg)
+	if err != nil {
 		return err
 	}
-
-	rawevent := request.Data["event"]
-	event := new(eventGridEvent)
-	if err := json.Unmarshal(rawevent, event); err != nil {
+	evt.setDeliveryId(deliveryId)
+	if err := enqueueJob(c, evt); err != nil {
 		return err
 	}
+	return c.NoContent(http.StatusAccepted)
+}
 
-	msg := new(queueMessage)
-	if err := json.Unmarshal(event.Data, msg); err != nil {
+const (
+	eventTypeCancelWorkflowRun = "CancelWorkflowRunJob"
+	eventTypeWorkflowCommand   = "WorkflowCommandJob"
+	eventTypeWorkflowJob       = "WorkflowJobJob"
+)
+
+func process(c echo.Context) error {
+	request := new(invokeRequest)
+	if err := c.Bind(request); err != nil {
 		return err
 	}
 
-	client, err := newGitHubClientAsApp(env, msg.InstallationId)
+	event, err := decodeTrigger(request.Data["event"])
 	if err != nil {
 		return err
 	}
 
-	run, _, err := client.Actions.GetWorkflowRunByID(context.Background(), msg.Owner, msg.RepositoryName, msg.WorkflowRunId)
-	if err != nil {
+	if err := handleJob(c, event); err != nil {
 		return err
 	}
 
-	workflow, _, err := client.Actions.GetWorkflowByID(context.Background(), msg.Owner, msg.RepositoryName, run.GetWorkflowID())
-	if err != nil {
+	response := invokeResponse{}
+	return c.JSON(http.StatusOK, response)
+}
+
+// handleJob processes the job enqueued by webhook.
+func handleJob(c echo.Context, event *eventGridEvent) (err error) {
+	meta := new(deliveryMeta)
+	if err := json.Unmarshal(event.Data, meta); err != nil {
 		return err
 	}
-
-	for _, prnum := range msg.PullRequestNums {
-		pr, _, err := client.PullRequests.Get(context.Background(), msg.Owner, msg.RepositoryName, prnum)
+	traced := new(traceMeta)
+	if err := json.Unmarshal(event.Data, traced); err != nil {
+		return err
+	}
+	ctx, span := tracer().Start(traceContext.Extract(c.Request().Context(), traced.TraceContext), "process "+event.EventType,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(attribute.String("github.delivery", meta.DeliveryId)))
+	defer func() { endSpan(span, err) }()
+	c.SetRequest(c.Request().WithContext(ctx))
+	claimedAt := getEnv(c).now()
+	if meta.DeliveryId != "" {
+		claimed, err := claimDelivery(ctx, getStore(c), meta.DeliveryId, claimedAt)
 		if err != nil {
 			return err
 		}
-
-		prfiles, _, err := client.PullRequests.ListFiles(context.Background(), msg.Owner, msg.RepositoryName, pr.GetNumber(), nil)
-		if err != nil {
-			return err
+		if !claimed {
+			c.Echo().Logger.Infof("delivery %s is already processed.", meta.DeliveryId)
+			return nil
 		}
+	}
 
-		for _, prfile := range prfiles {
-			if prfile.GetFilename() == workflow.GetPath() && prfile.GetStatus() == "added" {
-				response, _ := client.Actions.CancelWorkflowRunByID(context.Background(), msg.Owner, msg.RepositoryName, run.GetID())
-				c.Echo().Logger.Infof("%s", response)
-
-				commentTextBuf := bytes.NewBufferString("")
-				data := struct {
-					Opener string
-					Owner  string
-					RunUrl string
-				}{
-					Opener: pr.GetUser().GetLogin(),
-					Owner:  msg.Owner,
-					RunUrl: run.GetHTMLURL(),
-				}
-				if err := c.Echo().Renderer.Render(commentTextBuf, "comment.md", data, c); err != nil {
-					return err
-				}
-				commentText := commentTextBuf.String()
-				comment := github.IssueComment{Body: &commentText}
-
-				_, _, err = client.Issues.CreateComment(context.Background(), msg.Owner, msg.RepositoryName, pr.GetNumber(), &comment)
-				if err != nil {
-					return err
-				}
+	switch event.EventType {
+	case eventTypeWorkflowCommand:
+		err = processCommand(c, event)
+	case eventTypeWorkflowJob:
+		err = processWorkflowJob(c, event)
+	default:
+		err = processWorkflowRun(c, event)
+	}
+	if err != nil {
+		if meta.DeliveryId != "" {
+			if err := releaseDelivery(ctx, getStore(c), meta.DeliveryId); err != nil {
+				c.Echo().Logger.Error(err)
 			}
 		}
+		return err
 	}
-
-	response := invokeResponse{}
-	return c.JSON(http.StatusOK, response)
+	if meta.DeliveryId != "" {
+		if err := completeDelivery(ctx, getStore(c), meta.DeliveryId, claimedAt, getEnv(c).now()); err != nil {
+			c.Echo().Logger.Error(err)
+		}
+	}
+	return nil
 }
 
-func main() {
-	env := newEnv()
+func processWorkflowRun(c echo.Context, event *eventGridEvent) error {
+	msg := new(queueMessage)
+	if err := json.Unmarshal(event.Data, msg); err != nil {
+		return err
+	}
 
+	client, err := newGitHubClientAsApp(getEnv(c), msg.InstallationId)
+	if err != nil {
+		return err
+	}
+	login, err := appLogin(c.Request().Context(), getEnv(c))
+	if err != nil {
+		return err
+	}
+
+	return newChecker(c, client, login).checkWorkflowRun(c.Request().Context(), msg)
+}
+
+func newServer(env env, store kvStore) *echo.Echo {
 	e := echo.New()
 	if l, ok := e.Logger.(*log.Logger); ok {
 		l.SetLevel(log.INFO)
@@ -277,15 +371,93 @@ func main() {
 	e.Use(middleware.Logger())
 	e.Use(middleware.Recover())
 	e.Use(injectEnv(env))
-	e.Use(middleware.BodyDump(handleBodyDump))
+	e.Use(injectStore(store))
+	e.Use(middleware.BodyDump(bodyDump(env.config().Log)))
+	return e
+}
+
+func main() {
+	conf, err := loadConfig(os.LookupEnv)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	env := newEnv(conf)
+
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "serve":
+			err = serve(env, os.Args[2:])
+		case "audit":
+			err = runAudit(env, os.Args[2:], os.Stdout)
+		case "action":
+			logger := log.New("action")
+			logger.SetLevel(log.INFO)
+			err = runAction(newActionEnv(conf, os.Getenv), os.Getenv, logger)
+		default:
+			err = fmt.Errorf("unknown command %s", os.Args[1])
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err := conf.require(storageSettings...); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	e := newServer(env, newBlobStore(env, "state"))
+	logMetrics(e.Logger)
+	// the app is configured after the setup on Azure Functions.
+	if err := conf.require(appSettings...); err != nil {
+		e.Logger.Warnf("%s\nonly setup_github_app is available until the app is configured.", err)
+	}
+
+	shutdownTracing, err := setupTracing(context.Background(), env.config().TracesExporter)
+	if err != nil {
+		e.Logger.Fatal(err)
+	}
+
+	q, err := newFunctionsJobQueue(env.config().JobQueue)
+	if err != nil {
+		e.Logger.Fatal(err)
+	}
 
 	e.POST("/hello", hello, azureFunctionsHttpAware("req"))
 	e.POST("/setup_github_app", setupGitHubApp, azureFunctionsHttpAware("req"))
-	e.POST("/webhook", webhook, azureFunctionsHttpAware("req"), validatePayload)
+	e.POST("/webhook", webhook, azureFunctionsHttpAware("req"), injectJobQueue(q), validatePayload)
 	e.POST("/process", process)
 	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusNoContent) })
 
-	e.Logger.Fatal(e.Start(":" + env.port()))
+	// the host stops the handler by the signal. processing requests are completed, and batched spans are flushed.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := e.Shutdown(shutdownCtx); err != nil {
+			e.Logger.Error(err)
+		}
+	}()
+
+	err = e.Start(":" + env.config().Port)
+	if errors.Is(err, http.ErrServerClosed) {
+		<-stopped
+	}
+	flushCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := shutdownTracing(flushCtx); err != nil {
+		e.Logger.Error(err)
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		e.Logger.Fatal(err)
+	}
 }
 
 // vim:set noet:
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v35/github"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/yskszk63/cancel-workflow-run/guard"
+)
+
+const metricsNamespace = "cancel_workflow_run"
+
+// metricsRegistry is exposed at /metrics in serve mode.
+var metricsRegistry = prometheus.NewRegistry()
+
+// metricsEmit logs each observation as a json line in Functions mode, where nothing scrapes the process.
+var (
+	metricsMu   sync.Mutex
+	metricsEmit func(log.JSON)
+)
+
+func emitMetric(name, kind string, labels, values []string, value float64) {
+	metricsMu.Lock()
+	emit := metricsEmit
+	metricsMu.Unlock()
+	if emit == nil {
+		return
+	}
+
+	m := make(map[string]string, len(values))
+	for i, label := range labels {
+		m[label] = values[i]
+	}
+	emit(log.JSON{
+		"metric": metricsNamespace + "_" + name,
+		"type":   kind,
+		"labels": m,
+		"value":  value,
+	})
+}
+
+type counterVec struct {
+	vec    *prometheus.CounterVec
+	name   string
+	labels []string
+}
+
+func newCounter(r prometheus.Registerer, name, help string, labels ...string) counterVec {
+	vec := prometheus.NewCounterVec(prometheus.CounterOpts{Namespace: metricsNamespace, Name: name, Help: help}, labels)
+	r.MustRegister(vec)
+	return counterVec{vec: vec, name: name, labels: labels}
+}
+
+func (c counterVec) inc(values ...string) {
+	c.vec.WithLabelValues(values...).Inc()
+	emitMetric(c.name, "counter", c.labels, values, 1)
+}
+
+type histogramVec struct {
+	vec    *prometheus.HistogramVec
+	name   string
+	labels []string
+}
+
+func newHistogram(r prometheus.Registerer, name, help string, buckets []float64, labels ...string) histogramVec {
+	vec := prometheus.NewHistogramVec(prometheus.HistogramOpts{Namespace: metricsNamespace, Name: name, Help: help, Buckets: buckets}, labels)
+	r.MustRegister(vec)
+	return histogramVec{vec: vec, name: name, labels: labels}
+}
+
+func (h histogramVec) observe(value float64, values ...string) {
+	h.vec.WithLabelValues(values...).Observe(value)
+	emitMetric(h.name, "histogram", h.labels, values, value)
+}
+
+var (
+	webhooksReceived  = newCounter(metricsRegistry, "webhooks_received_total", "Webhooks received by event type and action.", "event", "action")
+	signatureFailures = newCounter(metricsRegistry, "webhook_signature_failures_total", "Webhooks rejected by the signature.")
+	jobsEnqueued      = newCounter(metricsRegistry, "jobs_enqueued_total", "Jobs enqueued by type.", "type")
+	runsEvaluated     = newCounter(metricsRegistry, "runs_evaluated_total", "Runs evaluated by kind and decision.", "kind", "decision")
+	runsCancelled     = newCounter(metricsRegistry, "runs_cancelled_total", "Runs requested to cancel by kind and outcome.", "kind", "outcome")
+	commentsPosted    = newCounter(metricsRegistry, "comments_posted_total", "Comments posted on pull requests.")
+	githubApiCalls    = newCounter(metricsRegistry, "github_api_calls_total", "GitHub API calls by endpoint and status.", "method", "endpoint", "status")
+	githubApiDuration = newHistogram(metricsRegistry, "github_api_call_duration_seconds", "Duration of GitHub API calls.",
+		[]float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}, "method", "endpoint")
+	cancelLatency = newHistogram(metricsRegistry, "cancel_latency_seconds", "Seconds from the run created to the cancellation.",
+		[]float64{1, 2, 5, 10, 30, 60, 120, 300, 600, 1800}, "kind")
+)
+
+var metricsHandler = echo.WrapHandler(promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{}))
+
+// logMetrics emits observations to the logger in Functions mode.
+func logMetrics(logger echo.Logger) {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+	metricsEmit = logger.Infoj
+}
+
+var (
+	shaSegment    = regexp.MustCompile(`^[0-9a-f]{40}$`)
+	numberSegment = regexp.MustCompile(`^[0-9]+$`)
+)
+
+// apiEndpoint templates the path to bound the cardinality. e.g. /repos/{owner}/{repo}/actions/runs/{id}
+func apiEndpoint(path string) string {
+	path = strings.TrimPrefix(path, "/api/v3")
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i := 0; i < len(segments); i++ {
+		switch {
+		case i > 0 && segments[i-1] == "contents":
+			segments = append(segments[:i], "{path}")
+		case i == 1 && segments[0] == "repos":
+			segments[i] = "{owner}"
+		case i == 2 && segments[0] == "repos":
+			segments[i] = "{repo}"
+		case i == 1 && (segments[0] == "users" || segments[0] == "orgs"):
+			segments[i] = "{owner}"
+		case i > 0 && segments[i-1] == "commits":
+			segments[i] = "{ref}"
+		case i > 0 && segments[i-1] == "collaborators":
+			segments[i] = "{user}"
+		case numberSegment.MatchString(segments[i]):
+			segments[i] = "{id}"
+		case shaSegment.MatchString(segments[i]):
+			segments[i] = "{ref}"
+		}
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+// metricsTransport counts GitHub API calls.
+type metricsTransport struct {
+	base http.RoundTripper
+}
+
+func (t *metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	res, err := t.base.RoundTrip(req)
+	endpoint := apiEndpoint(req.URL.Path)
+	status := "error"
+	if err == nil {
+		status = strconv.Itoa(res.StatusCode)
+	}
+	githubApiCalls.inc(req.Method, endpoint, status)
+	githubApiDuration.observe(time.Since(start).Seconds(), req.Method, endpoint)
+	return res, err
+}
+
+// webhookAction returns the action of the payload. Empty if absent. e.g. push
+func webhookAction(payload []byte) string {
+	var p struct {
+		Action string `json:"action"`
+	}
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return ""
+	}
+	return p.Action
+}
+
+// cancelOutcome trims the duration of the cancel result. e.g. "cancelled in 3s" -> "cancelled"
+func cancelOutcome(result string) string {
+	for _, sep := range []string{" in ", " as "} {
+		if i := strings.Index(result, sep); i >= 0 {
+			return result[:i]
+		}
+	}
+	return result
+}
+
+// observeActions counts actions taken for the run.
+func observeActions(kind string, run *github.WorkflowRun, actions []guard.ActionResult, now time.Time) {
+	for _, a := range actions {
+		if a.Error != "" {
+			continue
+		}
+		switch a.Action {
+		case "cancel":
+			outcome := cancelOutcome(a.Result)
+			runsCancelled.inc(kind, outcome)
+			if (outcome == "cancelled" || outcome == "force-cancelled") && a.Target == run.GetHTMLURL() && !run.GetCreatedAt().IsZero() {
+				cancelLatency.observe(now.Sub(run.GetCreatedAt().Time).Seconds(), kind)
+			}
+		case "comment":
+			commentsPosted.inc()
+		}
+	}
+}
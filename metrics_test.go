@@ -0,0 +1,177 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v35/github"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/yskszk63/cancel-workflow-run/guard"
+)
+
+// scrapeMetrics returns the metrics exposed at /metrics.
+func scrapeMetrics(t *testing.T) string {
+	e := echo.New()
+	e.GET("/metrics", metricsHandler)
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	res := httptest.NewRecorder()
+	e.ServeHTTP(res, req)
+	if res.Result().StatusCode != http.StatusOK {
+		t.Fatal(res.Result().StatusCode)
+	}
+	return res.Body.String()
+}
+
+func TestMetricsEmit(t *testing.T) {
+	r := prometheus.NewRegistry()
+	c := newCounter(r, "test_total", "Test counter.", "kind")
+	h := newHistogram(r, "test_seconds", "Test histogram.", []float64{1, 10})
+
+	var emitted []log.JSON
+	metricsMu.Lock()
+	metricsEmit = func(j log.JSON) {
+		emitted = append(emitted, j)
+	}
+	metricsMu.Unlock()
+	defer func() {
+		metricsMu.Lock()
+		metricsEmit = nil
+		metricsMu.Unlock()
+	}()
+	c.inc("a")
+	h.observe(5)
+
+	if len(emitted) != 2 || emitted[0]["metric"] != "cancel_workflow_run_test_total" || emitted[0]["type"] != "counter" || emitted[0]["value"] != float64(1) {
+		t.Fatal(emitted)
+	}
+	if labels := emitted[0]["labels"].(map[string]string); labels["kind"] != "a" {
+		t.Fatal(labels)
+	}
+	if emitted[1]["metric"] != "cancel_workflow_run_test_seconds" || emitted[1]["type"] != "histogram" || emitted[1]["value"] != float64(5) {
+		t.Fatal(emitted[1])
+	}
+	if n := testutil.ToFloat64(c.vec); n != 1 {
+		t.Fatal(n)
+	}
+}
+
+func TestApiEndpoint(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+	}{
+		{
+			in:   "/repos/o/r/actions/runs/123/cancel",
+			want: "/repos/{owner}/{repo}/actions/runs/{id}/cancel",
+		},
+		{
+			in:   "/api/v3/repos/o/r/contents/.github/workflows/ci.yml",
+			want: "/repos/{owner}/{repo}/contents/{path}",
+		},
+		{
+			in:   "/repos/o/r/commits/abc/check-runs",
+			want: "/repos/{owner}/{repo}/commits/{ref}/check-runs",
+		},
+		{
+			in:   "/repos/o/r/collaborators/octocat/permission",
+			want: "/repos/{owner}/{repo}/collaborators/{user}/permission",
+		},
+		{
+			in:   "/app/installations/1/access_tokens",
+			want: "/app/installations/{id}/access_tokens",
+		},
+		{
+			in:   "/orgs/o/members/octocat",
+			want: "/orgs/{owner}/members/octocat",
+		},
+		{
+			in:   "/search/issues",
+			want: "/search/issues",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.in, func(t *testing.T) {
+			if got := apiEndpoint(c.in); got != c.want {
+				t.Fatal(got)
+			}
+		})
+	}
+}
+
+func TestMetricsTransport(t *testing.T) {
+	dummy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer dummy.Close()
+
+	client := &http.Client{Transport: &metricsTransport{base: http.DefaultTransport}}
+	res, err := client.Get(dummy.URL + "/repos/transport/r/pulls/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	out := scrapeMetrics(t)
+	if !strings.Contains(out, `cancel_workflow_run_github_api_calls_total{endpoint="/repos/{owner}/{repo}/pulls/{id}",method="GET",status="404"}`) {
+		t.Fatal(out)
+	}
+	if !strings.Contains(out, `cancel_workflow_run_github_api_call_duration_seconds_count{endpoint="/repos/{owner}/{repo}/pulls/{id}",method="GET"}`) {
+		t.Fatal(out)
+	}
+}
+
+func TestObserveActions(t *testing.T) {
+	created := time.Unix(100, 0)
+	run := &github.WorkflowRun{
+		HTMLURL:   github.String("https://github.com/o/r/actions/runs/1"),
+		CreatedAt: &github.Timestamp{Time: created},
+	}
+	actions := []guard.ActionResult{
+		{Action: "cancel", Target: run.GetHTMLURL(), Result: "force-cancelled in 3s"},
+		{Action: "cancel", Target: "https://github.com/o/r/actions/runs/2", Result: "already completed as success"},
+		{Action: "cancel", Target: "https://github.com/o/r/actions/runs/3", Error: "500"},
+		{Action: "comment", Target: "#1", Result: "updated"},
+	}
+	observeActions("observe_test", run, actions, created.Add(42*time.Second))
+
+	out := scrapeMetrics(t)
+	for _, want := range []string{
+		`cancel_workflow_run_runs_cancelled_total{kind="observe_test",outcome="force-cancelled"} 1`,
+		`cancel_workflow_run_runs_cancelled_total{kind="observe_test",outcome="already completed"} 1`,
+		`cancel_workflow_run_cancel_latency_seconds_sum{kind="observe_test"} 42`,
+		`cancel_workflow_run_cancel_latency_seconds_count{kind="observe_test"} 1`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("%s not in %s", want, out)
+		}
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	e := echo.New()
+	e.GET("/metrics", metricsHandler)
+
+	webhooksReceived.inc("handler_test", webhookAction([]byte(`{"action":"completed"}`)))
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	res := httptest.NewRecorder()
+	e.ServeHTTP(res, req)
+
+	if res.Result().StatusCode != http.StatusOK {
+		t.Fatal(res.Result().StatusCode)
+	}
+	if !strings.HasPrefix(res.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Fatal(res.Header())
+	}
+	if !strings.Contains(res.Body.String(), `cancel_workflow_run_webhooks_received_total{action="completed",event="handler_test"} 1`) {
+		t.Fatal(res.Body.String())
+	}
+}
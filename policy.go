@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v35/github"
+	"github.com/yskszk63/cancel-workflow-run/guard"
+)
+
+const policyCacheTTL = 5 * time.Minute
+
+type policyCacheEntry struct {
+	// *guard.Policy or *guard.InstallationPolicy
+	policy  interface{}
+	expires time.Time
+}
+
+type policyCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]policyCacheEntry
+}
+
+func newPolicyCache(ttl time.Duration) *policyCache {
+	return &policyCache{
+		ttl:     ttl,
+		entries: make(map[string]policyCacheEntry),
+	}
+}
+
+var (
+	repoPolicies         = newPolicyCache(policyCacheTTL)
+	installationPolicies = newPolicyCache(policyCacheTTL)
+)
+
+func (p *policyCache) load(env env, key string, fetch func() (interface{}, error)) (interface{}, error) {
+	now := env.now()
+
+	p.mu.Lock()
+	entry, exists := p.entries[key]
+	p.mu.Unlock()
+	if exists && now.Before(entry.expires) {
+		return entry.policy, nil
+	}
+
+	policy, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	p.entries[key] = policyCacheEntry{
+		policy:  policy,
+		expires: now.Add(p.ttl),
+	}
+	p.mu.Unlock()
+	return policy, nil
+}
+
+func (p *policyCache) get(context context.Context, env env, client *github.Client, owner, repo string) (*guard.Policy, error) {
+	key := client.BaseURL.String() + owner + "/" + repo
+	policy, err := p.load(env, key, func() (interface{}, error) {
+		return guard.FetchPolicy(context, guard.NewClient(client), owner, repo)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return policy.(*guard.Policy), nil
+}
+
+// getInstallation returns the policy shared by repositories of the owner.
+func (p *policyCache) getInstallation(context context.Context, env env, client *github.Client, owner string) (*guard.InstallationPolicy, error) {
+	key := client.BaseURL.String() + owner
+	policy, err := p.load(env, key, func() (interface{}, error) {
+		return guard.FetchInstallationPolicy(context, guard.NewClient(client), owner)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return policy.(*guard.InstallationPolicy), nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v35/github"
+)
+
+type clockEnv struct {
+	env
+	clock time.Time
+}
+
+func (e *clockEnv) now() time.Time {
+	return e.clock
+}
+
+func TestPolicyCache(t *testing.T) {
+	cases := []struct {
+		name    string
+		status  int
+		content string
+		haserr  bool
+		enabled bool
+	}{
+		{
+			name:    "notfound",
+			status:  404,
+			enabled: true,
+		},
+		{
+			name:    "found",
+			status:  200,
+			content: "enabled: false",
+			enabled: false,
+		},
+		{
+			name:    "invalid",
+			status:  200,
+			content: "enabled: [",
+			haserr:  true,
+		},
+		{
+			name:   "error",
+			status: 500,
+			haserr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			hits := 0
+			dummy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/api/v3/repos/o/r/contents/.github/cancel-workflow-run.yml":
+					hits++
+					w.WriteHeader(c.status)
+					if c.status != 200 {
+						return
+					}
+					encoding := "base64"
+					content := base64.StdEncoding.EncodeToString([]byte(c.content))
+					fmt.Fprintf(w, `{"type":"file","encoding":%q,"content":%q}`, encoding, content)
+				default:
+					fmt.Printf("%s\n", r.URL)
+					w.WriteHeader(501)
+				}
+			}))
+			defer dummy.Close()
+
+			env := &clockEnv{
+				env:   newTestEnv(dummy.URL),
+				clock: time.Unix(0, 0),
+			}
+			client, err := github.NewEnterpriseClient(dummy.URL, dummy.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cache := newPolicyCache(time.Minute)
+			policy, err := cache.get(context.Background(), env, client, "o", "r")
+			if (err != nil) != c.haserr {
+				t.Fatal(err)
+			}
+			if err != nil {
+				return
+			}
+			if policy.Enabled != c.enabled {
+				t.Fatalf("%+v", policy)
+			}
+
+			if _, err := cache.get(context.Background(), env, client, "o", "r"); err != nil {
+				t.Fatal(err)
+			}
+			if hits != 1 {
+				t.Fatalf("cached: %d", hits)
+			}
+
+			env.clock = env.clock.Add(2 * time.Minute)
+			if _, err := cache.get(context.Background(), env, client, "o", "r"); err != nil {
+				t.Fatal(err)
+			}
+			if hits != 2 {
+				t.Fatalf("expired: %d", hits)
+			}
+		})
+	}
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// jobQueue carries jobs from webhook to process.
+type jobQueue interface {
+	// enqueue is called in webhook.
+	enqueue(c echo.Context, evt *eventGridEvent) error
+	// start consuming jobs by run.
+	// Jobs of output bindings are consumed by the Functions host through process, so nothing to do.
+	start(run func(*eventGridEvent) error)
+	// close waits for the consuming jobs.
+	close()
+}
+
+// kinds of job queue.
+const (
+	jobQueueEventGrid    = "eventgrid"
+	jobQueueStorageQueue = "storagequeue"
+	jobQueueMemory       = "memory"
+	jobQueueFile         = "file"
+)
+
+var errQueueFull = echo.NewHTTPError(http.StatusServiceUnavailable, "job queue is full.")
+
+// eventGridQueue outputs to the Event Grid output binding.
+type eventGridQueue struct {
+	output string
+}
+
+func newEventGridQueue(output string) *eventGridQueue {
+	return &eventGridQueue{
+		output: output,
+	}
+}
+
+func (q *eventGridQueue) enqueue(c echo.Context, evt *eventGridEvent) error {
+	setOutput(c, q.output, evt)
+	return nil
+}
+
+func (*eventGridQueue) start(run func(*eventGridEvent) error) {}
+
+func (*eventGridQueue) close() {}
+
+// storageQueue outputs to the Azure Storage Queue output binding.
+type storageQueue struct {
+	output string
+}
+
+func newStorageQueue(output string) *storageQueue {
+	return &storageQueue{
+		output: output,
+	}
+}
+
+func (q *storageQueue) enqueue(c echo.Context, evt *eventGridEvent) error {
+	j, err := json.Marshal(evt)
+	if err != nil {
+		return err
+	}
+	// queue message is a string.
+	setOutput(c, q.output, string(j))
+	return nil
+}
+
+func (*storageQueue) start(run func(*eventGridEvent) error) {}
+
+func (*storageQueue) close() {}
+
+// newFunctionsJobQueue returns the output binding "msg" of webhook.
+func newFunctionsJobQueue(kind string) (jobQueue, error) {
+	switch kind {
+	case jobQueueEventGrid:
+		return newEventGridQueue("msg"), nil
+	case jobQueueStorageQueue:
+		return newStorageQueue("msg"), nil
+	default:
+		return nil, fmt.Errorf("unknown job queue %q for Azure Functions", kind)
+	}
+}
+
+// decodeTrigger decodes the job from the trigger binding.
+// The Event Grid trigger is an object, and the Storage Queue trigger is a string of json.
+func decodeTrigger(raw json.RawMessage) (*eventGridEvent, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		raw = json.RawMessage(s)
+	}
+
+	event := new(eventGridEvent)
+	if err := json.Unmarshal(raw, event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// memoryQueue is a bounded in-process job queue. Jobs are lost on exit.
+type memoryQueue struct {
+	jobs    chan *eventGridEvent
+	workers int
+	logger  echo.Logger
+	wg      sync.WaitGroup
+}
+
+func newMemoryQueue(size, workers int, logger echo.Logger) *memoryQueue {
+	return &memoryQueue{
+		jobs:    make(chan *eventGridEvent, size),
+		workers: workers,
+		logger:  logger,
+	}
+}
+
+// enqueue never blocks. errQueueFull is returned if the queue is full.
+func (q *memoryQueue) enqueue(c echo.Context, evt *eventGridEvent) error {
+	select {
+	case q.jobs <- evt:
+		return nil
+	default:
+		return errQueueFull
+	}
+}
+
+func (q *memoryQueue) start(run func(*eventGridEvent) error) {
+	for i := 0; i < q.workers; i++ {
+		q.wg.Add(1)
+		go func() {
+			defer q.wg.Done()
+			for evt := range q.jobs {
+				if err := run(evt); err != nil {
+					q.logger.Errorf("job %s: %s", evt.Id, err)
+				}
+			}
+		}()
+	}
+}
+
+func (q *memoryQueue) close() {
+	close(q.jobs)
+	q.wg.Wait()
+}
+
+// fileQueue is a durable job queue on the directory.
+// Each job is a file, and moved between pending/, processing/ and failed/.
+// The file name starts with the time to run, and the failed job is delayed by renaming.
+type fileQueue struct {
+	dir         string
+	workers     int
+	interval    time.Duration
+	maxAttempts int
+	// retryDelay is doubled for each attempt.
+	retryDelay time.Duration
+	logger     echo.Logger
+
+	mu       sync.Mutex
+	attempts map[string]int
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+func newFileQueue(dir string, workers int, interval time.Duration, logger echo.Logger) (*fileQueue, error) {
+	for _, sub := range []string{"pending", "processing", "failed"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	q := &fileQueue{
+		dir:         dir,
+		workers:     workers,
+		interval:    interval,
+		maxAttempts: 5,
+		retryDelay:  10 * time.Second,
+		logger:      logger,
+		attempts:    make(map[string]int),
+		done:        make(chan struct{}),
+	}
+
+	// processing jobs were interrupted. retry them.
+	processing, err := os.ReadDir(filepath.Join(dir, "processing"))
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range processing {
+		if err := os.Rename(q.path("processing", entry.Name()), q.path("pending", entry.Name())); err != nil {
+			return nil, err
+		}
+	}
+	return q, nil
+}
+
+func (q *fileQueue) path(state, name string) string {
+	return filepath.Join(q.dir, state, name)
+}
+
+// jobName is sortable by the time to run.
+func jobName(notBefore time.Time, key string) string {
+	return fmt.Sprintf("%020d-%s", notBefore.UnixNano(), key)
+}
+
+// jobKey is the part of the name kept across retries.
+func jobKey(name string) string {
+	return name[strings.Index(name, "-")+1:]
+}
+
+// jobNotBefore returns the time to run, or zero if the name has no time.
+func jobNotBefore(name string) time.Time {
+	i := strings.Index(name, "-")
+	if i < 0 {
+		return time.Time{}
+	}
+	nanos, err := strconv.ParseInt(name[:i], 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
+
+func (q *fileQueue) enqueue(c echo.Context, evt *eventGridEvent) error {
+	j, err := json.Marshal(evt)
+	if err != nil {
+		return err
+	}
+
+	name := jobName(time.Now(), strings.ReplaceAll(evt.Id, string(filepath.Separator), "_")+".json")
+	tmp, err := os.CreateTemp(q.dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(j); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), q.path("pending", name))
+}
+
+// claim moves the oldest pending job to processing. Returns empty if nothing to run now.
+func (q *fileQueue) claim() (string, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	entries, err := os.ReadDir(filepath.Join(q.dir, "pending"))
+	if err != nil {
+		return "", err
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+
+	now := time.Now()
+	for _, name := range names {
+		if jobNotBefore(name).After(now) {
+			// the rest are later.
+			break
+		}
+		if err := os.Rename(q.path("pending", name), q.path("processing", name)); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return "", err
+		}
+		return name, nil
+	}
+	return "", nil
+}
+
+func (q *fileQueue) runOne(name string, run func(*eventGridEvent) error) {
+	processing := q.path("processing", name)
+
+	err := func() error {
+		j, err := os.ReadFile(processing)
+		if err != nil {
+			return err
+		}
+		evt := new(eventGridEvent)
+		if err := json.Unmarshal(j, evt); err != nil {
+			return err
+		}
+		return run(evt)
+	}()
+	key := jobKey(name)
+	if err == nil {
+		q.mu.Lock()
+		delete(q.attempts, key)
+		q.mu.Unlock()
+		if err := os.Remove(processing); err != nil {
+			q.logger.Error(err)
+		}
+		return
+	}
+
+	q.mu.Lock()
+	q.attempts[key]++
+	attempts := q.attempts[key]
+	q.mu.Unlock()
+
+	next := q.path("pending", jobName(time.Now().Add(q.retryDelay<<(attempts-1)), key))
+	if attempts >= q.maxAttempts {
+		next = q.path("failed", name)
+		q.mu.Lock()
+		delete(q.attempts, key)
+		q.mu.Unlock()
+	}
+	q.logger.Errorf("job %s (attempt %d): %s", name, attempts, err)
+	if err := os.Rename(processing, next); err != nil {
+		q.logger.Error(err)
+	}
+}
+
+func (q *fileQueue) start(run func(*eventGridEvent) error) {
+	for i := 0; i < q.workers; i++ {
+		q.wg.Add(1)
+		go func() {
+			defer q.wg.Done()
+			for {
+				name, err := q.claim()
+				if err != nil {
+					q.logger.Error(err)
+				}
+				if name != "" {
+					q.runOne(name, run)
+					continue
+				}
+
+				select {
+				case <-q.done:
+					return
+				case <-time.After(q.interval):
+				}
+			}
+		}()
+	}
+}
+
+// close waits for the processing jobs. Pending jobs are kept for next start.
+func (q *fileQueue) close() {
+	close(q.done)
+	q.wg.Wait()
+}
+
+func injectJobQueue(q jobQueue) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("JobQueue", q)
+			return next(c)
+		}
+	}
+}
+
+// getJobQueue returns the Event Grid output binding if not injected.
+func getJobQueue(c echo.Context) jobQueue {
+	if q, ok := c.Get("JobQueue").(jobQueue); ok {
+		return q
+	}
+	return newEventGridQueue("msg")
+}
+
+func enqueueJob(c echo.Context, evt *eventGridEvent) error {
+	if err := getJobQueue(c).enqueue(c, evt); err != nil {
+		return err
+	}
+	jobsEnqueued.inc(evt.EventType)
+	return nil
+}
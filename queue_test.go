@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestOutputBindingQueue(t *testing.T) {
+	tests := []struct {
+		name string
+		kind string
+	}{
+		{name: "eventgrid", kind: jobQueueEventGrid},
+		{name: "storagequeue", kind: jobQueueStorageQueue},
+	}
+
+	for _, c := range tests {
+		t.Run(c.name, func(t *testing.T) {
+			q, err := newFunctionsJobQueue(c.kind)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			e := echo.New()
+			ctx := e.NewContext(nil, nil)
+			if err := q.enqueue(ctx, &eventGridEvent{Id: "id"}); err != nil {
+				t.Fatal(err)
+			}
+
+			out := ctx.Get(contextAttrOutputs).(map[string]interface{})["msg"]
+			raw, err := json.Marshal(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			evt, err := decodeTrigger(raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if evt.Id != "id" {
+				t.Fatalf("%+v", evt)
+			}
+		})
+	}
+
+	if _, err := newFunctionsJobQueue(jobQueueMemory); err == nil {
+		t.Fatal("must be error")
+	}
+}
+
+func TestMemoryQueue(t *testing.T) {
+	e := echo.New()
+
+	var mu sync.Mutex
+	var ids []string
+	q := newMemoryQueue(10, 2, e.Logger)
+
+	for i := 0; i < 5; i++ {
+		if err := q.enqueue(nil, &eventGridEvent{Id: fmt.Sprint(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	q.start(func(evt *eventGridEvent) error {
+		mu.Lock()
+		defer mu.Unlock()
+		ids = append(ids, evt.Id)
+		return fmt.Errorf("logged")
+	})
+	q.close()
+
+	if len(ids) != 5 {
+		t.Fatal(ids)
+	}
+}
+
+func TestMemoryQueueFull(t *testing.T) {
+	e := echo.New()
+
+	q := newMemoryQueue(1, 0, e.Logger)
+
+	if err := q.enqueue(nil, &eventGridEvent{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.enqueue(nil, &eventGridEvent{}); err != errQueueFull {
+		t.Fatal(err)
+	}
+}
+
+func TestFileQueue(t *testing.T) {
+	e := echo.New()
+	dir := t.TempDir()
+
+	q, err := newFileQueue(dir, 1, 10*time.Millisecond, e.Logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"ok", "retry", "fail"} {
+		if err := q.enqueue(nil, &eventGridEvent{Id: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// pending jobs survive restart.
+	q, err = newFileQueue(dir, 1, 10*time.Millisecond, e.Logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.maxAttempts = 2
+	q.retryDelay = 50 * time.Millisecond
+
+	var mu sync.Mutex
+	runs := make(map[string]int)
+	ranAt := make(map[string][]time.Time)
+	q.start(func(evt *eventGridEvent) error {
+		mu.Lock()
+		defer mu.Unlock()
+		runs[evt.Id]++
+		ranAt[evt.Id] = append(ranAt[evt.Id], time.Now())
+		if evt.Id == "fail" || (evt.Id == "retry" && runs[evt.Id] == 1) {
+			return fmt.Errorf("logged")
+		}
+		return nil
+	})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		failed, _ := os.ReadDir(filepath.Join(dir, "failed"))
+		pending, _ := os.ReadDir(filepath.Join(dir, "pending"))
+		if len(failed) == 1 && len(pending) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timeout")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	q.close()
+
+	if runs["ok"] != 1 || runs["retry"] != 2 || runs["fail"] != 2 {
+		t.Fatal(runs)
+	}
+	if delay := ranAt["retry"][1].Sub(ranAt["retry"][0]); delay < q.retryDelay {
+		t.Fatalf("retried in %s", delay)
+	}
+	processing, _ := os.ReadDir(filepath.Join(dir, "processing"))
+	if len(processing) != 0 {
+		t.Fatal(processing)
+	}
+}
+
+func TestJobName(t *testing.T) {
+	notBefore := time.Unix(1, 2)
+	name := jobName(notBefore, "delivery-id.json")
+	if key := jobKey(name); key != "delivery-id.json" {
+		t.Fatal(key)
+	}
+	if at := jobNotBefore(name); !at.Equal(notBefore) {
+		t.Fatal(at)
+	}
+	if at := jobNotBefore("unknown.json"); !at.IsZero() {
+		t.Fatal(at)
+	}
+}
+
+func TestFileQueueRecover(t *testing.T) {
+	e := echo.New()
+	dir := t.TempDir()
+
+	q, err := newFileQueue(dir, 1, time.Millisecond, e.Logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := q.enqueue(nil, &eventGridEvent{Id: "id"}); err != nil {
+		t.Fatal(err)
+	}
+	// interrupted while processing.
+	if name, err := q.claim(); err != nil || name == "" {
+		t.Fatal(name, err)
+	}
+
+	q, err = newFileQueue(dir, 1, time.Millisecond, e.Logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, err := q.claim()
+	if err != nil || name == "" {
+		t.Fatal(name, err)
+	}
+}
+
+func TestDecodeTrigger(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		wantErr bool
+	}{
+		{name: "eventgrid", raw: `{"id":"id"}`},
+		{name: "storagequeue", raw: `"{\"id\":\"id\"}"`},
+		{name: "broken", raw: `"id"`, wantErr: true},
+	}
+
+	for _, c := range tests {
+		t.Run(c.name, func(t *testing.T) {
+			evt, err := decodeTrigger(json.RawMessage(c.raw))
+			if c.wantErr {
+				if err == nil {
+					t.Fatal("must be error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if evt.Id != "id" {
+				t.Fatalf("%+v", evt)
+			}
+		})
+	}
+}
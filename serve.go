@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// jobRunner runs handleJob outside of the http request.
+func jobRunner(e *echo.Echo, env env, store kvStore) func(*eventGridEvent) error {
+	return func(evt *eventGridEvent) error {
+		req, err := http.NewRequest(http.MethodPost, "/process", nil)
+		if err != nil {
+			return err
+		}
+		res := &bufferResponseWriter{
+			statusCode: http.StatusOK,
+			header:     http.Header{},
+			body:       bytes.NewBuffer([]byte{}),
+		}
+		c := e.NewContext(req, res)
+
+		h := func(c echo.Context) error {
+			return handleJob(c, evt)
+		}
+		return injectEnv(env)(injectStore(store)(h))(c)
+	}
+}
+
+// serve runs the bot as a plain http server without Azure Functions host.
+func serve(env env, args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	workers := flags.Int("workers", 4, "number of workers")
+	queueKind := flags.String("queue", jobQueueMemory, "kind of the job queue. (memory or file)")
+	queueSize := flags.Int("queue-size", 100, "size of the memory job queue")
+	queueDir := flags.String("queue-dir", "", "directory of the file job queue")
+	stateDir := flags.String("state-dir", "", "directory to store the state. (default: AzureWebJobsStorage)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	required := appSettings
+	if *stateDir == "" {
+		required = append(append([]string{}, appSettings...), storageSettings...)
+	}
+	if err := env.config().require(required...); err != nil {
+		return err
+	}
+
+	var store kvStore
+	if *stateDir != "" {
+		store = newFileStore(*stateDir)
+	} else {
+		store = newBlobStore(env, "state")
+	}
+
+	shutdownTracing, err := setupTracing(context.Background(), env.config().TracesExporter)
+	if err != nil {
+		return err
+	}
+	defer shutdownTracing(context.Background())
+
+	e := newServer(env, store)
+
+	var q jobQueue
+	switch *queueKind {
+	case jobQueueMemory:
+		q = newMemoryQueue(*queueSize, *workers, e.Logger)
+	case jobQueueFile:
+		if *queueDir == "" {
+			return fmt.Errorf("-queue-dir is required for the file job queue")
+		}
+		fq, err := newFileQueue(*queueDir, *workers, time.Second, e.Logger)
+		if err != nil {
+			return err
+		}
+		q = fq
+	default:
+		return fmt.Errorf("unknown job queue %q", *queueKind)
+	}
+	q.start(jobRunner(e, env, store))
+
+	e.POST("/webhook", webhook, injectJobQueue(q), validatePayload)
+	e.GET("/metrics", metricsHandler)
+	e.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusNoContent) })
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- e.Start(":" + env.config().Port)
+	}()
+
+	select {
+	case err := <-errc:
+		q.close()
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := e.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	q.close()
+	return nil
+}
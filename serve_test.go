@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestServeWebHook(t *testing.T) {
+	dummy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Printf("%s\n", r.URL)
+		w.WriteHeader(501)
+	}))
+	defer dummy.Close()
+
+	env := newTestEnv(dummy.URL)
+	store := newMemoryStore()
+	e := newServer(env, store)
+
+	done := make(chan *eventGridEvent, 1)
+	q := newMemoryQueue(1, 1, e.Logger)
+	q.start(func(evt *eventGridEvent) error {
+		done <- evt
+		return nil
+	})
+	defer q.close()
+	e.POST("/webhook", webhook, injectJobQueue(q))
+
+	req := httptest.NewRequest("POST", "/webhook", bytes.NewBufferString(`{"workflow_run":{"id":1}}`))
+	req.Header.Set("X-GitHub-Event", "workflow_run")
+	req.Header.Set("X-GitHub-Delivery", "delivery")
+	res := httptest.NewRecorder()
+	e.ServeHTTP(res, req)
+
+	if res.Result().StatusCode != http.StatusAccepted {
+		t.Fatalf("%d %s", res.Result().StatusCode, res.Body.String())
+	}
+	select {
+	case evt := <-done:
+		if evt.Id != "delivery" || evt.EventType != eventTypeCancelWorkflowRun {
+			t.Fatalf("%+v", evt)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+}
+
+func TestJobRunner(t *testing.T) {
+	env := newTestEnv("http://localhost")
+	store := newMemoryStore()
+	e := newServer(env, store)
+
+	if _, err := claimDelivery(context.Background(), store, "delivery", env.now()); err != nil {
+		t.Fatal(err)
+	}
+	evt, err := newEventGridEvent("subject", eventTypeCancelWorkflowRun, "0", queueMessage{DeliveryId: "delivery"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// already claimed. nothing to do.
+	if err := jobRunner(e, env, store)(evt); err != nil {
+		t.Fatal(err)
+	}
+}
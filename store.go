@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	"github.com/labstack/echo/v4"
+)
+
+// kvStore is a small key value store to keep the state of the bot.
+type kvStore interface {
+	// get returns nil if absent.
+	get(context context.Context, key string) ([]byte, error)
+	put(context context.Context, key string, value []byte) error
+	// putIfAbsent returns false if already exists.
+	putIfAbsent(context context.Context, key string, value []byte) (bool, error)
+	delete(context context.Context, key string) error
+	// list returns keys start with the prefix in order.
+	list(context context.Context, prefix string) ([]string, error)
+}
+
+type memoryStore struct {
+	mu      sync.Mutex
+	entries map[string][]byte
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		entries: make(map[string][]byte),
+	}
+}
+
+func (m *memoryStore) get(context context.Context, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.entries[key], nil
+}
+
+func (m *memoryStore) put(context context.Context, key string, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries[key] = value
+	return nil
+}
+
+func (m *memoryStore) putIfAbsent(context context.Context, key string, value []byte) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.entries[key]; exists {
+		return false, nil
+	}
+	m.entries[key] = value
+	return true, nil
+}
+
+func (m *memoryStore) delete(context context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, key)
+	return nil
+}
+
+func (m *memoryStore) list(context context.Context, prefix string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var result []string
+	for key := range m.entries {
+		if strings.HasPrefix(key, prefix) {
+			result = append(result, key)
+		}
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// blobStore stores each key as a blob in the container of AzureWebJobsStorage.
+type blobStore struct {
+	env       env
+	container string
+}
+
+func newBlobStore(env env, container string) *blobStore {
+	return &blobStore{
+		env:       env,
+		container: container,
+	}
+}
+
+func (b *blobStore) blob(context context.Context, key string) (*azblob.BlockBlobURL, error) {
+	cred, err := newAzblobCredential(b.env.config().StorageConnectionString)
+	if err != nil {
+		return nil, err
+	}
+	conurl, err := ensureContainer(context, b.env, cred, b.container)
+	if err != nil {
+		return nil, err
+	}
+	blob := conurl.NewBlockBlobURL(key)
+	return &blob, nil
+}
+
+func isStorageError(err error, code azblob.ServiceCodeType) bool {
+	serr, ok := err.(azblob.StorageError)
+	return ok && serr.ServiceCode() == code
+}
+
+func (b *blobStore) get(context context.Context, key string) ([]byte, error) {
+	blob, err := b.blob(context, key)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := blob.Download(context, 0, azblob.CountToEnd, azblob.BlobAccessConditions{}, false, azblob.ClientProvidedKeyOptions{})
+	if err != nil {
+		if isStorageError(err, azblob.ServiceCodeBlobNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	body := response.Body(azblob.RetryReaderOptions{})
+	defer body.Close()
+	return io.ReadAll(body)
+}
+
+func (b *blobStore) put(context context.Context, key string, value []byte) error {
+	blob, err := b.blob(context, key)
+	if err != nil {
+		return err
+	}
+
+	_, err = azblob.UploadBufferToBlockBlob(context, value, *blob, azblob.UploadToBlockBlobOptions{})
+	return err
+}
+
+func (b *blobStore) putIfAbsent(context context.Context, key string, value []byte) (bool, error) {
+	blob, err := b.blob(context, key)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = azblob.UploadBufferToBlockBlob(context, value, *blob, azblob.UploadToBlockBlobOptions{
+		AccessConditions: azblob.BlobAccessConditions{
+			ModifiedAccessConditions: azblob.ModifiedAccessConditions{
+				// fail if exists
+				IfNoneMatch: azblob.ETagAny,
+			},
+		},
+	})
+	if err != nil {
+		if isStorageError(err, azblob.ServiceCodeBlobAlreadyExists) ||
+			isStorageError(err, azblob.ServiceCodeConditionNotMet) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (b *blobStore) delete(context context.Context, key string) error {
+	blob, err := b.blob(context, key)
+	if err != nil {
+		return err
+	}
+
+	_, err = blob.Delete(context, azblob.DeleteSnapshotsOptionNone, azblob.BlobAccessConditions{})
+	if err != nil && !isStorageError(err, azblob.ServiceCodeBlobNotFound) {
+		return err
+	}
+	return nil
+}
+
+func (b *blobStore) list(context context.Context, prefix string) ([]string, error) {
+	cred, err := newAzblobCredential(b.env.config().StorageConnectionString)
+	if err != nil {
+		return nil, err
+	}
+	conurl, err := ensureContainer(context, b.env, cred, b.container)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []string
+	for marker := (azblob.Marker{}); marker.NotDone(); {
+		segment, err := conurl.ListBlobsFlatSegment(context, marker, azblob.ListBlobsSegmentOptions{Prefix: prefix})
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range segment.Segment.BlobItems {
+			result = append(result, item.Name)
+		}
+		marker = segment.NextMarker
+	}
+	return result, nil
+}
+
+// fileStore stores each key as a file under the directory.
+type fileStore struct {
+	dir string
+}
+
+func newFileStore(dir string) *fileStore {
+	return &fileStore{
+		dir: dir,
+	}
+}
+
+func (f *fileStore) path(key string) string {
+	return filepath.Join(f.dir, filepath.FromSlash(key))
+}
+
+func (f *fileStore) get(context context.Context, key string) ([]byte, error) {
+	b, err := os.ReadFile(f.path(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return b, nil
+}
+
+func (f *fileStore) put(context context.Context, key string, value []byte) error {
+	path := f.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	// replace atomically.
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(value); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (f *fileStore) putIfAbsent(context context.Context, key string, value []byte) (bool, error) {
+	path := f.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return false, err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		if os.IsExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	if _, err := file.Write(value); err != nil {
+		file.Close()
+		return false, err
+	}
+	return true, file.Close()
+}
+
+func (f *fileStore) delete(context context.Context, key string) error {
+	if err := os.Remove(f.path(key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (f *fileStore) list(context context.Context, prefix string) ([]string, error) {
+	// walk from the directory of the prefix.
+	root := f.dir
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		root = f.path(prefix[:i])
+	}
+
+	var result []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".tmp-") {
+			return nil
+		}
+		rel, err := filepath.Rel(f.dir, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if strings.HasPrefix(key, prefix) {
+			result = append(result, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+func injectStore(s kvStore) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set("Store", s)
+			return next(c)
+		}
+	}
+}
+
+func getStore(c echo.Context) kvStore {
+	return c.Get("Store").(kvStore)
+}
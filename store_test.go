@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// newDummyBlobServer emulates a part of the blob service.
+func newDummyBlobServer() *httptest.Server {
+	var mu sync.Mutex
+	blobs := make(map[string][]byte)
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if r.URL.Query().Get("comp") == "list" {
+			// no pagination.
+			var names []string
+			for path := range blobs {
+				name := strings.TrimPrefix(path, r.URL.Path+"/")
+				if name != path && strings.HasPrefix(name, r.URL.Query().Get("prefix")) {
+					names = append(names, name)
+				}
+			}
+			sort.Strings(names)
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(200)
+			fmt.Fprint(w, `<?xml version="1.0" encoding="utf-8"?><EnumerationResults><Blobs>`)
+			for _, name := range names {
+				fmt.Fprintf(w, `<Blob><Name>%s</Name><Properties></Properties></Blob>`, name)
+			}
+			fmt.Fprint(w, `</Blobs><NextMarker /></EnumerationResults>`)
+			return
+		}
+		if r.URL.Query().Get("restype") == "container" {
+			w.Header().Add("x-ms-error-code", "ContainerAlreadyExists")
+			w.WriteHeader(409)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			b, exists := blobs[r.URL.Path]
+			if !exists {
+				w.Header().Add("x-ms-error-code", "BlobNotFound")
+				w.WriteHeader(404)
+				return
+			}
+			w.WriteHeader(200)
+			w.Write(b)
+		case http.MethodPut:
+			if _, exists := blobs[r.URL.Path]; exists && r.Header.Get("If-None-Match") == "*" {
+				w.Header().Add("x-ms-error-code", "BlobAlreadyExists")
+				w.WriteHeader(409)
+				return
+			}
+			b, _ := io.ReadAll(r.Body)
+			blobs[r.URL.Path] = b
+			w.WriteHeader(201)
+		case http.MethodDelete:
+			if _, exists := blobs[r.URL.Path]; !exists {
+				w.Header().Add("x-ms-error-code", "BlobNotFound")
+				w.WriteHeader(404)
+				return
+			}
+			delete(blobs, r.URL.Path)
+			w.WriteHeader(202)
+		default:
+			w.WriteHeader(501)
+		}
+	}))
+}
+
+func testKvStore(t *testing.T, store kvStore) {
+	ctx := context.Background()
+
+	v, err := store.get(ctx, "a/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != nil {
+		t.Fatal(v)
+	}
+
+	created, err := store.putIfAbsent(ctx, "a/b", []byte("1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !created {
+		t.Fatal("not created")
+	}
+	created, err = store.putIfAbsent(ctx, "a/b", []byte("2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created {
+		t.Fatal("created twice")
+	}
+
+	if err := store.put(ctx, "a/b", []byte("3")); err != nil {
+		t.Fatal(err)
+	}
+	v, err = store.get(ctx, "a/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(v, []byte("3")) {
+		t.Fatal(string(v))
+	}
+
+	for _, key := range []string{"a/c", "a/d/e", "b/a"} {
+		if err := store.put(ctx, key, []byte("x")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	keys, err := store.list(ctx, "a/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(keys, []string{"a/b", "a/c", "a/d/e"}) {
+		t.Fatal(keys)
+	}
+	keys, err = store.list(ctx, "none/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 0 {
+		t.Fatal(keys)
+	}
+
+	if err := store.delete(ctx, "a/b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.delete(ctx, "a/b"); err != nil {
+		t.Fatal(err)
+	}
+	v, err = store.get(ctx, "a/b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != nil {
+		t.Fatal(v)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	testKvStore(t, newMemoryStore())
+}
+
+func TestBlobStore(t *testing.T) {
+	dummy := newDummyBlobServer()
+	defer dummy.Close()
+
+	testKvStore(t, newBlobStore(newTestEnv(dummy.URL), "state"))
+}
+
+func TestBlobStoreError(t *testing.T) {
+	dummy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.RawQuery, "restype=container") {
+			w.WriteHeader(201)
+			return
+		}
+		w.Header().Add("x-ms-error-code", "AuthorizationFailure")
+		w.WriteHeader(403)
+	}))
+	defer dummy.Close()
+
+	store := newBlobStore(newTestEnv(dummy.URL), "state")
+	if _, err := store.get(context.Background(), "a"); err == nil {
+		t.Fatal("get")
+	}
+	if _, err := store.putIfAbsent(context.Background(), "a", nil); err == nil {
+		t.Fatal("putIfAbsent")
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	testKvStore(t, newFileStore(t.TempDir()))
+}
@@ -3,19 +3,24 @@ package main
 import (
 	"bytes"
 	"testing"
+
+	"github.com/yskszk63/cancel-workflow-run/guard"
 )
 
 func TestTemplatesComment(t *testing.T) {
 	r := newTemplateRenderer()
 	b := bytes.NewBufferString("")
-	var data = struct {
-		Opener string
-		Owner  string
-		RunUrl string
-	}{
+	data := &guard.CommentData{
 		Opener: "opener",
 		Owner:  "owner",
-		RunUrl: "url",
+		Runs: []*guard.RunEntry{
+			{
+				Name:   "CI",
+				Url:    "url",
+				Status: "cancelled",
+				Reason: "currently could not accept added at pull request",
+			},
+		},
 	}
 	err := r.Render(b, "comment.md", data, nil)
 	if err != nil {
@@ -25,10 +30,13 @@ func TestTemplatesComment(t *testing.T) {
 	expect := `@opener @owner
 Hi, I'm a bot.
 
-Sorry, [This Workflow Run](url) is cancelled.
-Because currently could not accept added at pull request.
+Sorry, following workflow runs are cancelled.
+
+| Workflow Run | Status | Reason |
+| --- | --- | --- |
+| [CI](url) | cancelled | currently could not accept added at pull request |
 
-If needed, please re-run [This Workflow Run](url)
+If needed, a user with write permission can re-run the workflow run or comment ` + "`/approve-workflows`" + ` to approve.
 `
 	if b.String() != expect {
 		t.Fatal(b.String())
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "cancel-workflow-run"
+
+// exporters of spans. (OTEL_TRACES_EXPORTER)
+const (
+	tracesExporterNone   = "none"
+	tracesExporterOtlp   = "otlp"
+	tracesExporterStdout = "stdout"
+)
+
+// traceContext propagates W3C trace context from webhook to process.
+var traceContext = propagation.TraceContext{}
+
+func tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// setupTracing installs the tracer provider exporting spans.
+// The OTLP exporter is configured by OTEL_EXPORTER_OTLP_* variables.
+func setupTracing(ctx context.Context, kind string) (func(context.Context) error, error) {
+	var opt sdktrace.TracerProviderOption
+	switch kind {
+	case tracesExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case tracesExporterOtlp:
+		exporter, err := otlptracehttp.New(ctx)
+		if err != nil {
+			return nil, err
+		}
+		opt = sdktrace.WithBatcher(exporter)
+	case tracesExporterStdout:
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		if err != nil {
+			return nil, err
+		}
+		opt = sdktrace.WithSyncer(exporter)
+	default:
+		return nil, fmt.Errorf("unknown traces exporter %q", kind)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		opt,
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(tracerName))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// traceCarrier is the W3C trace context in the message. e.g. traceparent
+type traceCarrier map[string]string
+
+func (t traceCarrier) Get(key string) string {
+	return t[key]
+}
+
+func (t traceCarrier) Set(key, value string) {
+	t[key] = value
+}
+
+func (t traceCarrier) Keys() []string {
+	keys := make([]string, 0, len(t))
+	for key := range t {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// injectTraceContext returns the trace context to carry in the message.
+func injectTraceContext(context context.Context) traceCarrier {
+	carrier := traceCarrier{}
+	traceContext.Inject(context, carrier)
+	if len(carrier) == 0 {
+		return nil
+	}
+	return carrier
+}
+
+// traceMeta is the common part of the messages to resume the trace.
+type traceMeta struct {
+	TraceContext traceCarrier `json:"TraceContext"`
+}
+
+// endSpan records the error, and ends the span.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func webhookSpanAttributes(event, action, deliveryId string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("github.event", event),
+		attribute.String("github.action", action),
+		attribute.String("github.delivery", deliveryId),
+	}
+}
+
+// tracingTransport traces GitHub API calls.
+func tracingTransport(base http.RoundTripper) http.RoundTripper {
+	return otelhttp.NewTransport(base, otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+		return fmt.Sprintf("%s %s", r.Method, apiEndpoint(r.URL.Path))
+	}))
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v35/github"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestInjectTraceContext(t *testing.T) {
+	if carrier := injectTraceContext(context.Background()); carrier != nil {
+		t.Fatal(carrier)
+	}
+
+	provider := sdktrace.NewTracerProvider()
+	ctx, span := provider.Tracer("test").Start(context.Background(), "test")
+	defer span.End()
+
+	carrier := injectTraceContext(ctx)
+	if carrier.Get("traceparent") == "" {
+		t.Fatal(carrier)
+	}
+	resumed := trace.SpanContextFromContext(traceContext.Extract(context.Background(), carrier))
+	if resumed.TraceID() != span.SpanContext().TraceID() || resumed.SpanID() != span.SpanContext().SpanID() {
+		t.Fatal(resumed)
+	}
+}
+
+func TestSetupTracing(t *testing.T) {
+	shutdown, err := setupTracing(context.Background(), tracesExporterNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := setupTracing(context.Background(), "zipkin"); err == nil {
+		t.Fatal("unknown exporter")
+	}
+}
+
+func TestTracePropagation(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	original := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(original)
+
+	dummy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/app/installations/1/access_tokens" {
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(github.InstallationToken{
+				Token:     github.String("token"),
+				ExpiresAt: &time.Time{},
+			})
+			return
+		}
+		if r.URL.Path == "/api/v3/app" {
+			fmt.Fprint(w, `{"slug":"app"}`)
+			return
+		}
+		w.WriteHeader(http.StatusNotImplemented)
+	}))
+	defer dummy.Close()
+
+	env := newTestEnv(dummy.URL)
+	store := newMemoryStore()
+	e := newServer(env, store)
+
+	done := make(chan *eventGridEvent, 1)
+	q := newMemoryQueue(1, 1, e.Logger)
+	q.start(func(evt *eventGridEvent) error {
+		done <- evt
+		return nil
+	})
+	defer q.close()
+	e.POST("/webhook", webhook, injectJobQueue(q))
+
+	req := httptest.NewRequest("POST", "/webhook", bytes.NewBufferString(`{"action":"requested","workflow_run":{"id":2},"installation":{"id":1}}`))
+	req.Header.Set("X-GitHub-Event", "workflow_run")
+	req.Header.Set("X-GitHub-Delivery", "delivery")
+	e.ServeHTTP(httptest.NewRecorder(), req)
+
+	var evt *eventGridEvent
+	select {
+	case evt = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout")
+	}
+
+	// the dummy returns 501 for the run.
+	if err := jobRunner(e, env, store)(evt); err == nil {
+		t.Fatal("no error")
+	}
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	webhookSpan, exists := spans["webhook workflow_run"]
+	if !exists {
+		t.Fatal(spans)
+	}
+	processSpan, exists := spans["process "+eventTypeCancelWorkflowRun]
+	if !exists {
+		t.Fatal(spans)
+	}
+	if processSpan.Parent().SpanID() != webhookSpan.SpanContext().SpanID() {
+		t.Fatalf("%v != %v", processSpan.Parent(), webhookSpan.SpanContext())
+	}
+	if processSpan.SpanKind() != trace.SpanKindConsumer {
+		t.Fatal(processSpan.SpanKind())
+	}
+	for _, name := range []string{"POST /app/installations/{id}/access_tokens", "GET /repos/{owner}/{repo}/actions/runs/{id}"} {
+		span, exists := spans[name]
+		if !exists {
+			t.Fatalf("%s: %v", name, spans)
+		}
+		if span.Parent().SpanID() != processSpan.SpanContext().SpanID() {
+			t.Fatalf("%s: %v", name, span.Parent())
+		}
+	}
+}
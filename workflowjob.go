@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/google/go-github/v35/github"
+	"github.com/labstack/echo/v4"
+	"github.com/yskszk63/cancel-workflow-run/guard"
+)
+
+// workflow_job event is not supported by go-github v35.
+type workflowJobPayload struct {
+	Action      string `json:"action"`
+	WorkflowJob struct {
+		ID         int64    `json:"id"`
+		RunID      int64    `json:"run_id"`
+		RunAttempt int      `json:"run_attempt"`
+		HeadSHA    string   `json:"head_sha"`
+		Name       string   `json:"name"`
+		HTMLURL    string   `json:"html_url"`
+		Labels     []string `json:"labels"`
+	} `json:"workflow_job"`
+	Repo         *github.Repository   `json:"repository"`
+	Installation *github.Installation `json:"installation"`
+	// Sender triggered the job, e.g. the user who re-runs.
+	Sender *github.User `json:"sender"`
+}
+
+type jobMessage struct {
+	InstallationId  int64        `json:"InstallationId"`
+	Owner           string       `json:"Owner"`
+	RepositoryName  string       `json:"RepositoryName"`
+	JobId           int64        `json:"JobId"`
+	WorkflowRunId   int64        `json:"WorkflowRunId"`
+	Labels          []string     `json:"Labels"`
+	RunAttempt      int          `json:"RunAttempt"`
+	TriggeringActor string       `json:"TriggeringActor"`
+	DeliveryId      string       `json:"DeliveryId"`
+	TraceContext    traceCarrier `json:"TraceContext,omitempty"`
+}
+
+// workflowJobWebhook enqueues queued jobs. Protected labels are checked by process,
+// because they are configured per installation.
+func workflowJobWebhook(c echo.Context, payload []byte, deliveryId string) error {
+	event := new(workflowJobPayload)
+	if err := json.Unmarshal(payload, event); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error()).SetInternal(err)
+	}
+	if event.Action != "queued" || len(event.WorkflowJob.Labels) == 0 {
+		return c.NoContent(http.StatusNoContent)
+	}
+
+	msg := jobMessage{
+		InstallationId:  event.Installation.GetID(),
+		Owner:           event.Repo.GetOwner().GetLogin(),
+		RepositoryName:  event.Repo.GetName(),
+		JobId:           event.WorkflowJob.ID,
+		WorkflowRunId:   event.WorkflowJob.RunID,
+		Labels:          event.WorkflowJob.Labels,
+		RunAttempt:      event.WorkflowJob.RunAttempt,
+		TriggeringActor: event.Sender.GetLogin(),
+		DeliveryId:      deliveryId,
+		TraceContext:    injectTraceContext(c.Request().Context()),
+	}
+	evt, err := newEventGridEvent(fmt.Sprintf("%d", msg.InstallationId), eventTypeWorkflowJob, "0", msg)
+	if err != nil {
+		return err
+	}
+	evt.setDeliveryId(deliveryId)
+	if err := enqueueJob(c, evt); err != nil {
+		return err
+	}
+	return c.NoContent(http.StatusAccepted)
+}
+
+func processWorkflowJob(c echo.Context, event *eventGridEvent) error {
+	msg := new(jobMessage)
+	if err := json.Unmarshal(event.Data, msg); err != nil {
+		return err
+	}
+
+	client, err := newGitHubClientAsApp(getEnv(c), msg.InstallationId)
+	if err != nil {
+		return err
+	}
+	login, err := appLogin(c.Request().Context(), getEnv(c))
+	if err != nil {
+		return err
+	}
+
+	return newChecker(c, client, login).checkWorkflowJob(c.Request().Context(), msg)
+}
+
+// checkWorkflowJob cancels the run of untrusted pull requests, if the job aims at protected runners.
+func (k *checker) checkWorkflowJob(context context.Context, msg *jobMessage) error {
+	client := k.client
+
+	installation, err := installationPolicies.getInstallation(context, k.env, client, msg.Owner)
+	if err != nil {
+		k.logger.Warnf("%s: %s. fallback to default policy.", msg.Owner, err)
+		installation = guard.DefaultInstallationPolicy()
+	}
+	label := installation.Runners.ProtectedLabel(msg.Labels)
+	if label == "" {
+		return nil
+	}
+
+	policy, err := repoPolicies.get(context, k.env, client, msg.Owner, msg.RepositoryName)
+	if err != nil {
+		k.logger.Warnf("%s/%s: %s. fallback to default policy.", msg.Owner, msg.RepositoryName, err)
+		policy = guard.DefaultPolicy()
+	}
+	if !policy.Enabled {
+		return nil
+	}
+	if k.withoutChecks && policy.Actions.Check {
+		p := *policy
+		p.Actions.Check = false
+		policy = &p
+	}
+
+	run, _, err := client.Actions.GetWorkflowRunByID(context, msg.Owner, msg.RepositoryName, msg.WorkflowRunId)
+	if err != nil {
+		return err
+	}
+	if run.GetEvent() != "pull_request" {
+		return nil
+	}
+	// the re-run by a maintainer is approved as on workflow_run, which may be processed later.
+	a, err := k.approveByRerun(context, msg.Owner, msg.RepositoryName, run, msg.RunAttempt, msg.TriggeringActor)
+	if err != nil || a != nil {
+		return err
+	}
+
+	gclient := k.guardClient()
+	pullRequestNums, err := guard.ResolvePullRequests(context, gclient, msg.Owner, msg.RepositoryName, run)
+	if err != nil {
+		return err
+	}
+
+	workflow, _, err := client.Actions.GetWorkflowByID(context, msg.Owner, msg.RepositoryName, run.GetWorkflowID())
+	if err != nil {
+		return err
+	}
+	if policy.IsExemptPath(workflow.GetPath()) {
+		return nil
+	}
+
+	executor := &guard.Executor{
+		Client: gclient,
+		Policy: policy,
+		Render: commentRenderer(k.renderer),
+		Logger: k.logger,
+	}
+	for _, prnum := range pullRequestNums {
+		pr, _, err := client.PullRequests.Get(context, msg.Owner, msg.RepositoryName, prnum)
+		if err != nil {
+			return err
+		}
+		record := &auditRecord{
+			Kind:           auditWorkflowJob,
+			InstallationId: msg.InstallationId,
+			Owner:          msg.Owner,
+			Repo:           msg.RepositoryName,
+			PullRequest:    pr.GetNumber(),
+			RunId:          run.GetID(),
+			Sha:            run.GetHeadSHA(),
+			Decision:       "skip",
+			DryRun:         policy.DryRun,
+		}
+		if policy.IsExemptUser(pr.GetUser().GetLogin()) {
+			record.Reasons = []string{"exempt user"}
+			k.recordAudit(context, record)
+			continue
+		}
+		trusted, why, err := policy.Trust.TrustedAuthor(context, gclient, msg.Owner, msg.RepositoryName, pr)
+		if err != nil {
+			return err
+		}
+		if trusted {
+			k.logger.Infof("#%d: job %d on %s is allowed. (%s)", pr.GetNumber(), msg.JobId, label, why)
+			record.Reasons = []string{fmt.Sprintf("trusted author (%s)", why)}
+			k.recordAudit(context, record)
+			continue
+		}
+
+		decision := &guard.Decision{
+			Cancel:   true,
+			Reason:   fmt.Sprintf("%s (%s)", guard.ReasonSelfHosted, label),
+			Workflow: workflow.GetPath(),
+		}
+		record.Decision = "cancel"
+		record.Reasons = []string{decision.Reason}
+		executor.OnAction = func(r guard.ActionResult) {
+			record.Actions = append(record.Actions, r)
+		}
+		err = executor.Execute(context, msg.Owner, msg.RepositoryName, run, pr, decision)
+		observeActions(auditWorkflowJob, run, record.Actions, k.env.now())
+		k.recordAudit(context, record)
+		// the run is cancelled. other pull requests of the sha have nothing to do.
+		return err
+	}
+	return nil
+}
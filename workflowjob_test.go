@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-github/v35/github"
+	"github.com/labstack/echo/v4"
+)
+
+func TestProcessWorkflowJob(t *testing.T) {
+	cases := []struct {
+		name         string
+		labels       []string
+		installation string
+		event        string
+		permission   string
+		approved     bool
+		// actor re-runs the run.
+		actor      string
+		wantCancel bool
+	}{
+		{
+			name:       "self-hosted",
+			labels:     []string{"self-hosted", "linux"},
+			wantCancel: true,
+		},
+		{
+			name:   "github hosted",
+			labels: []string{"ubuntu-latest"},
+		},
+		{
+			name:       "trusted",
+			labels:     []string{"self-hosted"},
+			permission: "write",
+		},
+		{
+			name:         "allowed label",
+			labels:       []string{"self-hosted", "ephemeral"},
+			installation: "runners: {allowed: [ephemeral]}",
+		},
+		{
+			name:         "protected label",
+			labels:       []string{"gpu"},
+			installation: "runners: {protected: [gpu]}",
+			wantCancel:   true,
+		},
+		{
+			name:   "push",
+			labels: []string{"self-hosted"},
+			event:  "push",
+		},
+		{
+			name:     "approved",
+			labels:   []string{"self-hosted"},
+			approved: true,
+		},
+		{
+			name:   "rerun by maintainer",
+			labels: []string{"self-hosted"},
+			actor:  "maintainer",
+		},
+		{
+			name:       "rerun by opener",
+			labels:     []string{"self-hosted"},
+			actor:      "opener",
+			wantCancel: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cancelled, commented := false, false
+			dummy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/app/installations/0/access_tokens":
+					w.WriteHeader(200)
+					json.NewEncoder(w).Encode(github.InstallationToken{})
+				case "/api/v3/app":
+					fmt.Fprint(w, `{"slug":"app"}`)
+				case "/api/v3/repos/o/.github/contents/cancel-workflow-run.yml":
+					if c.installation == "" {
+						w.WriteHeader(404)
+						return
+					}
+					content := base64.StdEncoding.EncodeToString([]byte(c.installation))
+					fmt.Fprintf(w, `{"type":"file","encoding":"base64","content":%q}`, content)
+				case "/api/v3/repos/o/r/contents/.github/cancel-workflow-run.yml":
+					w.WriteHeader(404)
+				case "/api/v3/repos/o/r/actions/runs/1":
+					if cancelled {
+						fmt.Fprint(w, `{"id":1,"status":"completed","conclusion":"cancelled"}`)
+						return
+					}
+					event := c.event
+					if event == "" {
+						event = "pull_request"
+					}
+					fmt.Fprintf(w, `{"id":1,"event":%q,"workflow_id":3,"head_sha":"abc","head_branch":"feature","head_repository":{"owner":{"login":"fork"}}}`, event)
+				case "/api/v3/repos/o/r/pulls":
+					fmt.Fprint(w, `[{"number":2,"head":{"sha":"abc"}}]`)
+				case "/api/v3/repos/o/r/actions/workflows/3":
+					fmt.Fprint(w, `{"id":3,"path":".github/workflows/ci.yml"}`)
+				case "/api/v3/repos/o/r/pulls/2":
+					fmt.Fprint(w, `{"number":2,"user":{"login":"opener"},"head":{"sha":"abc","ref":"feature"}}`)
+				case "/api/v3/repos/o/r/collaborators/maintainer/permission":
+					fmt.Fprint(w, `{"permission":"write"}`)
+				case "/api/v3/repos/o/r/collaborators/opener/permission":
+					fmt.Fprintf(w, `{"permission":%q}`, c.permission)
+				case "/api/v3/repos/o/r/actions/runs/1/cancel":
+					cancelled = true
+					w.WriteHeader(202)
+				case "/api/v3/repos/o/r/actions/runs":
+					fmt.Fprint(w, `{"workflow_runs":[]}`)
+				case "/api/v3/repos/o/r/commits/abc/check-runs":
+					fmt.Fprint(w, `{"total_count":0,"check_runs":[]}`)
+				case "/api/v3/repos/o/r/check-runs":
+					w.WriteHeader(201)
+					fmt.Fprint(w, `{"id":7}`)
+				case "/api/v3/repos/o/r/issues/2/comments":
+					if r.Method == http.MethodPost {
+						commented = true
+						w.WriteHeader(201)
+						fmt.Fprint(w, `{}`)
+						return
+					}
+					fmt.Fprint(w, `[]`)
+				default:
+					fmt.Printf("%s\n", r.URL)
+					w.WriteHeader(501)
+				}
+			}))
+			defer dummy.Close()
+
+			store := newMemoryStore()
+			if c.approved {
+				if err := recordApproval(context.Background(), store, "o", "r", &approval{Sha: "abc"}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			e := echo.New()
+			e.Debug = true
+			e.Use(injectEnv(newTestEnv(dummy.URL)))
+			e.Use(injectStore(store))
+			e.Renderer = testRenderer{}
+			e.POST("/", process)
+
+			msg := jobMessage{
+				Owner:          "o",
+				RepositoryName: "r",
+				JobId:          9,
+				WorkflowRunId:  1,
+				Labels:         c.labels,
+			}
+			if c.actor != "" {
+				msg.RunAttempt = 2
+				msg.TriggeringActor = c.actor
+			}
+			evt, err := newEventGridEvent("subject", eventTypeWorkflowJob, "0", msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			j, err := json.Marshal(evt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, err := json.Marshal(invokeRequest{
+				Data: map[string]json.RawMessage{
+					"event": j,
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest("POST", "/", bytes.NewBuffer(body))
+			req.Header.Set("Content-Type", "application/json")
+			res := httptest.NewRecorder()
+			e.ServeHTTP(res, req)
+
+			if res.Result().StatusCode != http.StatusOK {
+				t.Fatalf("%d %s", res.Result().StatusCode, res.Body.String())
+			}
+			if cancelled != c.wantCancel {
+				t.Fatalf("cancelled: %v", cancelled)
+			}
+			if commented != c.wantCancel {
+				t.Fatalf("commented: %v", commented)
+			}
+
+			a, err := findApproval(context.Background(), store, "o", "r", "abc")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (a != nil) != (c.approved || c.actor == "maintainer") {
+				t.Fatalf("%+v", a)
+			}
+		})
+	}
+}